@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"path/filepath"
 
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/afkarxyz/SpotiFLAC/backend"
@@ -19,10 +21,13 @@ import (
 
 type App struct {
 	ctx context.Context
+
+	jobs     map[string]*downloadJob
+	jobsLock sync.Mutex
 }
 
 func NewApp() *App {
-	return &App{}
+	return &App{jobs: make(map[string]*downloadJob)}
 }
 
 func (a *App) getFirstArtist(artistString string) string {
@@ -44,9 +49,14 @@ func (a *App) startup(ctx context.Context) {
 	if err := backend.InitHistoryDB("SpotiFLAC"); err != nil {
 		fmt.Printf("Failed to init history DB: %v\n", err)
 	}
+
+	backend.OnStatusChange(a.onDownloadStatusChange)
+	backend.SetDispatchGate(a.hasDownloadJob)
+	backend.SetDispatchHandler(a.runDownloadJob)
 }
 
 func (a *App) shutdown(ctx context.Context) {
+	backend.CloseProgressLog()
 	backend.CloseHistoryDB()
 }
 
@@ -246,13 +256,11 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		req.AudioFormat = "LOSSLESS"
 	}
 
-	var err error
-	var filename string
-
 	if req.FilenameFormat == "" {
 		req.FilenameFormat = "title-artist"
 	}
 
+	var job *downloadJob
 	itemID := req.ItemID
 	if itemID == "" {
 
@@ -262,12 +270,218 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 			itemID = fmt.Sprintf("%s-%s-%d", req.TrackName, req.ArtistName, time.Now().UnixNano())
 		}
 
-		backend.AddToQueue(itemID, req.TrackName, req.ArtistName, req.AlbumName, req.SpotifyID)
+		job = a.addDownloadJob(itemID, req)
+		if err := backend.AddToQueueFull(backend.QueueRequest{
+			ID:         itemID,
+			TrackName:  req.TrackName,
+			ArtistName: req.ArtistName,
+			AlbumName:  req.AlbumName,
+			SpotifyID:  req.SpotifyID,
+			Source:     req.Service,
+		}); err != nil {
+			a.removeDownloadJob(itemID)
+			if errors.Is(err, backend.ErrRecentlyCompleted) {
+				return DownloadResponse{
+					Success:       true,
+					Message:       "Track was completed recently",
+					AlreadyExists: true,
+					ItemID:        itemID,
+				}, nil
+			}
+			return DownloadResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to queue download: %v", err),
+			}, err
+		}
+	} else {
+		backend.SetItemSource(itemID, req.Service)
+		job = a.addDownloadJob(itemID, req)
+		backend.TriggerDispatch()
+	}
+
+	return a.waitForDownload(itemID, job)
+}
+
+// downloadJob carries the request for an item that DownloadTrack queued until
+// the dispatcher starts it. running is non-nil while runDownloadJob is
+// downloading the item, and result holds the outcome of the run that finished
+// the item. Both are guarded by App.jobsLock.
+type downloadJob struct {
+	req        DownloadRequest
+	finished   chan struct{}
+	finishOnce sync.Once
+	running    chan struct{}
+	result     *downloadResult
+}
+
+type downloadResult struct {
+	resp DownloadResponse
+	err  error
+}
+
+func (a *App) addDownloadJob(itemID string, req DownloadRequest) *downloadJob {
+	job := &downloadJob{req: req, finished: make(chan struct{})}
+	a.jobsLock.Lock()
+	a.jobs[itemID] = job
+	a.jobsLock.Unlock()
+	return job
+}
+
+func (a *App) removeDownloadJob(itemID string) {
+	a.jobsLock.Lock()
+	delete(a.jobs, itemID)
+	a.jobsLock.Unlock()
+}
+
+// hasDownloadJob is the dispatch gate: only items with a request are started.
+// It runs under the queue lock, so it must not call into the backend.
+func (a *App) hasDownloadJob(itemID string) bool {
+	a.jobsLock.Lock()
+	defer a.jobsLock.Unlock()
+	_, ok := a.jobs[itemID]
+	return ok
+}
+
+func (a *App) finishDownloadJob(itemID string) {
+	a.jobsLock.Lock()
+	job := a.jobs[itemID]
+	a.jobsLock.Unlock()
+	if job != nil {
+		job.finishOnce.Do(func() { close(job.finished) })
+	}
+}
+
+// finishRemovedDownloadJobs wakes the DownloadTrack calls whose items were
+// removed from the queue, since removal is not a status change.
+func (a *App) finishRemovedDownloadJobs() {
+	a.jobsLock.Lock()
+	ids := make([]string, 0, len(a.jobs))
+	for id := range a.jobs {
+		ids = append(ids, id)
+	}
+	a.jobsLock.Unlock()
+
+	for _, id := range ids {
+		if _, ok := backend.GetQueueItem(id); !ok {
+			a.finishDownloadJob(id)
+		}
+	}
+}
+
+func (a *App) onDownloadStatusChange(itemID string, from, to backend.DownloadStatus) {
+	if isFinishedStatus(to) {
+		a.finishDownloadJob(itemID)
+	}
+}
+
+func isFinishedStatus(status backend.DownloadStatus) bool {
+	return status == backend.StatusCompleted || status == backend.StatusFailed || status == backend.StatusSkipped
+}
+
+// runDownloadJob is the dispatch handler. It downloads the item with the
+// request DownloadTrack queued for it, using the source URL resolved for this
+// attempt when there is one, and keeps the result when the run
+// finished the item rather than requeueing it for a retry.
+func (a *App) runDownloadJob(item backend.DownloadItem) {
+	a.jobsLock.Lock()
+	job := a.jobs[item.ID]
+	if job != nil {
+		job.running = make(chan struct{})
+		job.result = nil
+	}
+	a.jobsLock.Unlock()
+
+	if job == nil {
+		if current, ok := backend.GetQueueItem(item.ID); ok && current.Status == backend.StatusDownloading {
+			backend.FailDownloadItem(item.ID, "No download request for this item")
+		}
+		backend.ReleaseDownloadItem(item.ID)
+		return
+	}
+
+	req := job.req
+	if current, ok := backend.GetQueueItem(item.ID); ok && current.SourceURL != "" {
+		req.ServiceURL = current.SourceURL
 	}
+	resp, err := a.downloadItem(item.ID, req)
+	current, ok := backend.GetQueueItem(item.ID)
 
-	backend.SetDownloading(true)
-	backend.StartDownloadItem(itemID)
-	defer backend.SetDownloading(false)
+	a.jobsLock.Lock()
+	if !ok || isFinishedStatus(current.Status) {
+		job.result = &downloadResult{resp: resp, err: err}
+	}
+	close(job.running)
+	job.running = nil
+	a.jobsLock.Unlock()
+}
+
+// waitForDownload blocks until the item finishes or leaves the queue and
+// returns the outcome of the run that finished it. Items that finished without
+// being run, such as rejected, cancelled or duplicate items, are reported from
+// their queue state.
+func (a *App) waitForDownload(itemID string, job *downloadJob) (DownloadResponse, error) {
+	if item, ok := backend.GetQueueItem(itemID); !ok || isFinishedStatus(item.Status) {
+		a.finishDownloadJob(itemID)
+	}
+	<-job.finished
+
+	a.jobsLock.Lock()
+	delete(a.jobs, itemID)
+	running := job.running
+	a.jobsLock.Unlock()
+	if running != nil {
+		<-running
+	}
+
+	a.jobsLock.Lock()
+	result := job.result
+	a.jobsLock.Unlock()
+	if result != nil {
+		return result.resp, result.err
+	}
+
+	item, ok := backend.GetQueueItem(itemID)
+	switch {
+	case !ok:
+		err := fmt.Errorf("item %s was removed from the queue", itemID)
+		return DownloadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Download failed: %v", err),
+			ItemID:  itemID,
+		}, err
+	case item.Status == backend.StatusCompleted:
+		return DownloadResponse{
+			Success: true,
+			Message: "Download completed successfully",
+			File:    item.FilePath,
+			ItemID:  itemID,
+		}, nil
+	case item.Status == backend.StatusFailed:
+		err := errors.New(item.ErrorMessage)
+		return DownloadResponse{
+			Success: false,
+			Error:   item.ErrorMessage,
+			ItemID:  itemID,
+		}, err
+	default:
+		return DownloadResponse{
+			Success: false,
+			Error:   item.ErrorMessage,
+			File:    item.FilePath,
+			ItemID:  itemID,
+		}, nil
+	}
+}
+
+// downloadItem runs the download for an item the dispatcher has started and
+// moves it to its final status.
+func (a *App) downloadItem(itemID string, req DownloadRequest) (DownloadResponse, error) {
+	var err error
+	var filename string
+
+	backend.SetItemDownloading(itemID, true)
+	defer backend.SetItemDownloading(itemID, false)
+	defer backend.ReleaseDownloadItem(itemID)
 
 	spotifyURL := ""
 	if req.SpotifyID != "" {
@@ -318,11 +532,12 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		}
 	}
 
+	var expectedPath, plannedPath string
 	if req.TrackName != "" && req.ArtistName != "" {
 		expectedFilename := backend.BuildExpectedFilename(req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.FilenameFormat, req.PlaylistName, req.PlaylistOwner, req.TrackNumber, req.Position, req.SpotifyDiscNumber, req.UseAlbumTrackNumber)
-		expectedPath := filepath.Join(req.OutputDir, expectedFilename)
+		expectedPath = filepath.Join(req.OutputDir, expectedFilename)
 
-		if fileInfo, err := os.Stat(expectedPath); err == nil && fileInfo.Size() > 100*1024 {
+		if backend.ExistingFileComplete(itemID, expectedPath) {
 
 			backend.SkipDownloadItem(itemID, expectedPath)
 			return DownloadResponse{
@@ -333,6 +548,17 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 				ItemID:        itemID,
 			}, nil
 		}
+
+		plannedPath, err = backend.PlanItemPath(itemID, expectedPath)
+		if errors.Is(err, backend.ErrPathCollision) {
+			return DownloadResponse{
+				Success:       true,
+				Message:       "File already exists",
+				File:          expectedPath,
+				AlreadyExists: true,
+				ItemID:        itemID,
+			}, nil
+		}
 	}
 
 	lyricsChan := make(chan string, 1)
@@ -368,6 +594,9 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 	case "amazon":
 
 		downloader := backend.NewAmazonDownloader()
+
+		downloader.SetItemID(itemID)
+		downloader.SetOutputPath(plannedPath)
 		if req.ServiceURL != "" {
 			filename, err = downloader.DownloadByURL(req.ServiceURL, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.PlaylistName, req.PlaylistOwner, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.CoverURL, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.EmbedMaxQualityCover, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.UseFirstArtistOnly, req.UseSingleGenre, req.EmbedGenre)
 		} else {
@@ -377,6 +606,8 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 	case "tidal":
 		if req.ApiURL == "" || req.ApiURL == "auto" {
 			downloader := backend.NewTidalDownloader("")
+			downloader.SetItemID(itemID)
+			downloader.SetOutputPath(plannedPath)
 			if req.ServiceURL != "" {
 				filename, err = downloader.DownloadByURLWithFallback(req.ServiceURL, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly, req.UseSingleGenre, req.EmbedGenre)
 			} else {
@@ -384,6 +615,8 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 			}
 		} else {
 			downloader := backend.NewTidalDownloader(req.ApiURL)
+			downloader.SetItemID(itemID)
+			downloader.SetOutputPath(plannedPath)
 			if req.ServiceURL != "" {
 				filename, err = downloader.DownloadByURL(req.ServiceURL, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly, req.UseSingleGenre, req.EmbedGenre)
 			} else {
@@ -396,6 +629,8 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		fmt.Println("Waiting for ISRC (Qobuz dependency)...")
 		isrc := <-isrcChan
 		downloader := backend.NewQobuzDownloader()
+		downloader.SetItemID(itemID)
+		downloader.SetOutputPath(plannedPath)
 		quality := req.AudioFormat
 		if quality == "" {
 			quality = "6"
@@ -404,9 +639,12 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 
 	case "deezer":
 		downloader := backend.NewDeezerDownloader()
+		downloader.SetItemID(itemID)
+		downloader.SetOutputPath(plannedPath)
 		filename, err = downloader.Download(req.SpotifyID, req.OutputDir, req.FilenameFormat, req.PlaylistName, req.PlaylistOwner, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.CoverURL, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.EmbedMaxQualityCover, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.UseFirstArtistOnly, req.UseSingleGenre, req.EmbedGenre)
 
 	default:
+		backend.FailDownloadItem(itemID, fmt.Sprintf("Unknown service: %s", req.Service))
 		return DownloadResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Unknown service: %s", req.Service),
@@ -414,7 +652,7 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 	}
 
 	if err != nil {
-		backend.FailDownloadItem(itemID, fmt.Sprintf("Download failed: %v", err))
+		backend.FailDownloadItemErr(itemID, fmt.Errorf("Download failed: %w", err))
 
 		if filename != "" && !strings.HasPrefix(filename, "EXISTS:") {
 
@@ -576,14 +814,25 @@ func (a *App) ClearCompletedDownloads() {
 
 func (a *App) ClearAllDownloads() {
 	backend.ClearAllDownloads()
+	a.finishRemovedDownloadJobs()
 }
 
 func (a *App) AddToDownloadQueue(spotifyID, trackName, artistName, albumName string) string {
 	itemID := fmt.Sprintf("%s-%d", spotifyID, time.Now().UnixNano())
-	backend.AddToQueue(itemID, trackName, artistName, albumName, "")
+	if err := backend.AddToQueue(itemID, trackName, artistName, albumName, ""); err != nil {
+		if errors.Is(err, backend.ErrRecentlyCompleted) {
+			return itemID
+		}
+		fmt.Printf("Failed to queue %s - %s: %v\n", trackName, artistName, err)
+		return ""
+	}
 	return itemID
 }
 
+func (a *App) AddToDownloadQueueBatch(items []backend.QueueRequest) backend.BatchResult {
+	return backend.AddBatch(items)
+}
+
 func (a *App) MarkDownloadItemFailed(itemID, errorMsg string) {
 	backend.FailDownloadItem(itemID, errorMsg)
 }
@@ -592,6 +841,40 @@ func (a *App) CancelAllQueuedItems() {
 	backend.CancelAllQueuedItems()
 }
 
+func (a *App) RedownloadItem(itemID string) error {
+	return backend.RedownloadItem(itemID)
+}
+
+func (a *App) RetryDownloadItem(itemID string) error {
+	return backend.RetryItem(itemID)
+}
+
+func (a *App) MarkDownloadImported(itemID, filePath string, size int64) error {
+	return backend.MarkImported(itemID, filePath, size)
+}
+
+func (a *App) PinDownloadItem(itemID string) error {
+	return backend.PinItem(itemID)
+}
+
+func (a *App) UnpinDownloadItem(itemID string) error {
+	return backend.UnpinItem(itemID)
+}
+
+func (a *App) RemoveDownloadItem(itemID string) bool {
+	removed := backend.RemoveQueueItem(itemID)
+	a.finishRemovedDownloadJobs()
+	return removed
+}
+
+func (a *App) GetDiagnostics() backend.DiagnosticsReport {
+	return backend.SelfCheck()
+}
+
+func (a *App) GetSessionStats() backend.SessionStats {
+	return backend.GetSessionStats()
+}
+
 func (a *App) ExportFailedDownloads() (string, error) {
 	queueInfo := backend.GetDownloadQueue()
 	var failedItems []string
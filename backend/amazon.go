@@ -15,8 +15,10 @@ import (
 )
 
 type AmazonDownloader struct {
-	client  *http.Client
-	regions []string
+	client     *http.Client
+	regions    []string
+	itemID     string
+	outputPath string
 }
 
 type SongLinkResponse struct {
@@ -39,6 +41,17 @@ func NewAmazonDownloader() *AmazonDownloader {
 	}
 }
 
+func (a *AmazonDownloader) SetItemID(itemID string) {
+	a.itemID = itemID
+}
+
+// SetOutputPath names the downloaded file after path, the one planned for the
+// item, instead of the name built from the filename format. The extension of
+// the delivered file is kept.
+func (a *AmazonDownloader) SetOutputPath(path string) {
+	a.outputPath = path
+}
+
 func (a *AmazonDownloader) GetAmazonURLFromSpotify(spotifyTrackID string) (string, error) {
 
 	spotifyBase := "https://open.spotify.com/track/"
@@ -112,7 +125,7 @@ func (a *AmazonDownloader) DownloadFromAfkarXYZ(amazonURL, outputDir, quality st
 	}
 
 	apiURL := fmt.Sprintf("https://amzn.afkarxyz.fun/api/track/%s", asin)
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := newItemRequest(a.itemID, "GET", apiURL, nil)
 	if err != nil {
 		return "", err
 	}
@@ -147,27 +160,38 @@ func (a *AmazonDownloader) DownloadFromAfkarXYZ(amazonURL, outputDir, quality st
 	fileName := fmt.Sprintf("%s.m4a", asin)
 	filePath := filepath.Join(outputDir, fileName)
 
-	out, err := os.Create(filePath)
+	out, target, err := createTempFile(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer out.Close()
 
-	dlReq, _ := http.NewRequest("GET", downloadURL, nil)
+	dlReq, err := newItemDownloadRequest(a.itemID, "GET", downloadURL, nil)
+	if err != nil {
+		return "", err
+	}
 	dlReq.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/145.0.0.0 Safari/537.36")
+	applyItemHeaders(dlReq, a.itemID)
 
 	dlResp, err := a.client.Do(dlReq)
 	if err != nil {
-		return "", err
+		return "", transferError(a.itemID, err, 0)
 	}
 	defer dlResp.Body.Close()
 
 	fmt.Printf("Downloading track: %s\n", fileName)
-	pw := NewProgressWriter(out)
-	_, err = io.Copy(pw, dlResp.Body)
+	pw := NewProgressWriterWithID(out, a.itemID)
+	_, err = io.Copy(pw, pw.ResponseBody(dlResp))
+	if finishErr := pw.Finish(); err == nil {
+		err = finishErr
+	}
+	if err == nil {
+		err = out.Close()
+	}
 	if err != nil {
-		out.Close()
-		os.Remove(filePath)
+		return "", transferError(a.itemID, err, pw.GetTotal())
+	}
+	if err := commitTempFile(a.itemID, target, filePath); err != nil {
 		return "", err
 	}
 
@@ -261,10 +285,8 @@ func (a *AmazonDownloader) DownloadFromService(amazonURL, outputDir, quality str
 
 func (a *AmazonDownloader) DownloadByURL(amazonURL, outputDir, quality, filenameFormat, playlistName, playlistOwner string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate, spotifyCoverURL string, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, embedMaxQualityCover bool, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, useFirstArtistOnly bool, useSingleGenre bool, embedGenre bool) (string, error) {
 
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create output directory: %w", err)
-		}
+	if err := ensureOutputDir(outputDir); err != nil {
+		return "", err
 	}
 
 	if spotifyTrackName != "" && spotifyArtistName != "" {
@@ -275,7 +297,7 @@ func (a *AmazonDownloader) DownloadByURL(amazonURL, outputDir, quality, filename
 			filenameAlbumArtist = GetFirstArtist(spotifyAlbumArtist)
 		}
 		expectedFilename := BuildExpectedFilename(spotifyTrackName, filenameArtist, spotifyAlbumName, filenameAlbumArtist, spotifyReleaseDate, filenameFormat, playlistName, playlistOwner, includeTrackNumber, position, spotifyDiscNumber, false)
-		expectedPath := filepath.Join(outputDir, expectedFilename)
+		expectedPath := plannedOutputPath(a.outputPath, filepath.Join(outputDir, expectedFilename))
 
 		if fileInfo, err := os.Stat(expectedPath); err == nil && fileInfo.Size() > 0 {
 			fmt.Printf("File already exists: %s (%.2f MB)\n", expectedPath, float64(fileInfo.Size())/(1024*1024))
@@ -400,7 +422,7 @@ func (a *AmazonDownloader) DownloadByURL(amazonURL, outputDir, quality, filename
 			ext = ".flac"
 		}
 		newFilename = newFilename + ext
-		newFilePath := filepath.Join(outputDir, newFilename)
+		newFilePath := plannedOutputPath(a.outputPath, filepath.Join(outputDir, newFilename))
 
 		if err := os.Rename(filePath, newFilePath); err != nil {
 			fmt.Printf("Warning: Failed to rename file: %v\n", err)
@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	autoPauseAfter     atomic.Int64
+	autoPauseCompleted atomic.Int64
+)
+
+// SetAutoPauseAfter pauses the queue once n items have completed since the
+// last ResumeQueue, so downloads run in batches that can be reviewed in
+// between. Only successful completions count. 0 disables it. Setting it
+// starts a new batch.
+func SetAutoPauseAfter(n int) {
+	if n < 0 {
+		n = 0
+	}
+	autoPauseAfter.Store(int64(n))
+	autoPauseCompleted.Store(0)
+}
+
+// remainingUntilPause returns how many more completions will pause the queue,
+// or -1 when auto-pause is off.
+func remainingUntilPause() int {
+	limit := autoPauseAfter.Load()
+	if limit == 0 {
+		return -1
+	}
+	remaining := limit - autoPauseCompleted.Load()
+	if remaining < 0 {
+		remaining = 0
+	}
+	return int(remaining)
+}
+
+func countAutoPauseCompletion() {
+	limit := autoPauseAfter.Load()
+	if limit == 0 {
+		return
+	}
+	if autoPauseCompleted.Add(1) == limit {
+		fmt.Printf("[AutoPause] %d downloads completed, pausing queue\n", limit)
+		PauseQueue()
+	}
+}
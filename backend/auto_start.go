@@ -0,0 +1,210 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	queuePaused            atomic.Bool
+	autoStartDisabled      atomic.Bool
+	maxConcurrentDownloads atomic.Int64
+
+	dispatchHandler     func(item DownloadItem)
+	dispatchGate        func(id string) bool
+	dispatchHandlerLock sync.RWMutex
+)
+
+// PauseQueue stops dispatching new items. The reported speed drops to zero and
+// the session timer is frozen until ResumeQueue, so paused time is excluded
+// from uptime and average speed.
+func PauseQueue() {
+	pauseQueue()
+}
+
+// ResumeQueue restarts dispatching and begins a new SetAutoPauseAfter batch.
+// It also ends a pause made by SetSchedule.
+func ResumeQueue() {
+	autoPauseCompleted.Store(0)
+	schedulePaused.Store(false)
+	unpauseQueue()
+}
+
+// pauseQueue pauses dispatch and reports whether this call paused it.
+func pauseQueue() bool {
+	if !queuePaused.CompareAndSwap(false, true) {
+		return false
+	}
+	beginSessionPause()
+
+	speedLock.Lock()
+	currentSpeed = 0
+	speedLock.Unlock()
+	return true
+}
+
+// unpauseQueue lifts the pause without touching the auto-pause batch or the
+// schedule state.
+func unpauseQueue() {
+	if !queuePaused.CompareAndSwap(true, false) {
+		return
+	}
+	endSessionPause()
+
+	speedLock.Lock()
+	recomputeSpeedLocked()
+	speedLock.Unlock()
+
+	triggerAutoStart()
+}
+
+func IsQueuePaused() bool {
+	return queuePaused.Load()
+}
+
+// SetMaxConcurrentDownloads caps how many items the dispatcher keeps in the
+// downloading state. 0 means no limit.
+func SetMaxConcurrentDownloads(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxConcurrentDownloads.Store(int64(n))
+	triggerAutoStart()
+}
+
+// SetAutoStart controls whether newly added items are dispatched right away.
+// It is on by default. Dispatch only happens while the queue is not paused,
+// fewer than SetMaxConcurrentDownloads items are downloading, and a handler
+// has been registered with SetDispatchHandler; the handler runs in its own
+// goroutine and must complete, fail or skip the item it is given. With
+// auto-start off, items stay queued until StartNext or StartDownloadItem is
+// called.
+func SetAutoStart(enabled bool) {
+	autoStartDisabled.Store(!enabled)
+	if enabled {
+		triggerAutoStart()
+	}
+}
+
+func SetDispatchHandler(handler func(item DownloadItem)) {
+	dispatchHandlerLock.Lock()
+	dispatchHandler = handler
+	dispatchHandlerLock.Unlock()
+	triggerAutoStart()
+}
+
+// SetDispatchGate restricts dispatch to the queued items gate accepts. The
+// others stay queued, and are not returned by StartNext, until TriggerDispatch
+// is called after the gate lets them through. The gate is called with the
+// queue lock held, so it must not call back into the queue. Passing nil makes
+// every queued item eligible again.
+func SetDispatchGate(gate func(id string) bool) {
+	dispatchHandlerLock.Lock()
+	dispatchGate = gate
+	dispatchHandlerLock.Unlock()
+	triggerAutoStart()
+}
+
+func dispatchAllowed(id string) bool {
+	dispatchHandlerLock.RLock()
+	gate := dispatchGate
+	dispatchHandlerLock.RUnlock()
+	return gate == nil || gate(id)
+}
+
+// TriggerDispatch hands eligible queued items to the dispatch handler, as
+// adding an item does. Like auto-start, it does nothing while auto-start is
+// off or the queue is paused.
+func TriggerDispatch() {
+	triggerAutoStart()
+}
+
+func triggerAutoStart() {
+	if autoStartDisabled.Load() || queuePaused.Load() {
+		return
+	}
+
+	dispatchHandlerLock.RLock()
+	handler := dispatchHandler
+	dispatchHandlerLock.RUnlock()
+	if handler == nil {
+		return
+	}
+
+	go func() {
+		for {
+			item, ok := startNextItem()
+			if !ok {
+				return
+			}
+			go handler(item)
+		}
+	}()
+}
+
+func hasDispatchCapacityLocked() bool {
+	limit := int(maxConcurrentDownloads.Load())
+	return limit == 0 || downloadingCountLocked() < limit
+}
+
+func downloadingCountLocked() int {
+	downloading := 0
+	for _, item := range downloadQueue {
+		if item.Status == StatusDownloading {
+			downloading++
+		}
+	}
+	return downloading
+}
+
+func startNextItem() (DownloadItem, bool) {
+	for {
+		if queuePaused.Load() {
+			return DownloadItem{}, false
+		}
+
+		downloadQueueLock.Lock()
+		if !hasDispatchCapacityLocked() {
+			downloadQueueLock.Unlock()
+			return DownloadItem{}, false
+		}
+		index := selectNextLocked(true)
+		if index < 0 {
+			downloadQueueLock.Unlock()
+			return DownloadItem{}, false
+		}
+		if hasPreDownloadFilter() {
+			candidate := downloadQueue[index]
+			downloadQueueLock.Unlock()
+
+			if err := admitItem(candidate); err != nil {
+				continue
+			}
+
+			downloadQueueLock.Lock()
+			index = indexOfItemLocked(candidate.ID)
+			if index < 0 || downloadQueue[index].Status != StatusQueued || !hasDispatchCapacityLocked() {
+				downloadQueueLock.Unlock()
+				continue
+			}
+		}
+		started := markStartedLocked(index)
+		downloadQueueLock.Unlock()
+
+		if err := afterStart(started.ID, started, true); err != nil {
+			continue
+		}
+		return started, true
+	}
+}
+
+// StartNext promotes the next eligible queued item to downloading and returns
+// its ID. It honours the dispatch strategy, held items, the pause state and
+// SetMaxConcurrentDownloads, and does not invoke the dispatch handler.
+func StartNext() (string, bool) {
+	item, ok := startNextItem()
+	if !ok {
+		return "", false
+	}
+	return item.ID, true
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) setRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.rate = bytesPerSecond
+	l.tokens = float64(bytesPerSecond)
+	l.last = time.Now()
+}
+
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if burst := float64(l.rate); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+var (
+	globalLimiter    rateLimiter
+	itemLimiters     = make(map[string]*rateLimiter)
+	itemLimitersLock sync.RWMutex
+)
+
+func SetBandwidthLimit(bytesPerSecond int64) {
+	globalLimiter.setRate(bytesPerSecond)
+}
+
+func SetItemBandwidthLimit(id string, bytesPerSecond int64) {
+	itemLimitersLock.Lock()
+	defer itemLimitersLock.Unlock()
+
+	if bytesPerSecond <= 0 {
+		delete(itemLimiters, id)
+		return
+	}
+
+	limiter, ok := itemLimiters[id]
+	if !ok {
+		limiter = &rateLimiter{}
+		itemLimiters[id] = limiter
+	}
+	limiter.setRate(bytesPerSecond)
+}
+
+func clearItemBandwidthLimit(id string) {
+	itemLimitersLock.Lock()
+	delete(itemLimiters, id)
+	itemLimitersLock.Unlock()
+}
+
+func resetItemBandwidthLimits() {
+	itemLimitersLock.Lock()
+	itemLimiters = make(map[string]*rateLimiter)
+	itemLimitersLock.Unlock()
+}
+
+func throttleWrite(itemID string, n int) {
+	wait := globalLimiter.reserve(n)
+	if wait > 0 {
+		markGlobalThrottle()
+	}
+
+	if itemID != "" {
+		itemLimitersLock.RLock()
+		limiter := itemLimiters[itemID]
+		itemLimitersLock.RUnlock()
+
+		if limiter != nil {
+			if itemWait := limiter.reserve(n); itemWait > wait {
+				wait = itemWait
+			}
+		}
+	}
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
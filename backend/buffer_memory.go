@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+	"sync"
+)
+
+type bufferBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	freed chan struct{}
+}
+
+var bufferMemory = &bufferBudget{freed: make(chan struct{})}
+
+// SetMaxBufferMemory caps the memory held by in-flight copy and write buffers
+// across all downloads. Each transfer and each parallel segment needs one
+// copy buffer (SetCopyBufferSize), and a transfer using SetMaxConcurrentWrites
+// also holds a 1 MiB write buffer, so the cap divided by those sizes bounds how
+// many can stream at once regardless of SetMaxConcurrentDownloads and
+// SetParallelSegments. Transfers wait for memory before they start; buffers of
+// transfers already streaming are counted but never wait, so a running
+// download cannot deadlock. 0, the default, removes the cap.
+func SetMaxBufferMemory(bytes int64) {
+	if bytes < 0 {
+		bytes = 0
+	}
+	b := bufferMemory
+	b.mu.Lock()
+	b.limit = bytes
+	b.signalLocked()
+	b.mu.Unlock()
+}
+
+// GetBufferMemory returns the bytes currently held by download buffers and
+// the cap set with SetMaxBufferMemory.
+func GetBufferMemory() (used, limit int64) {
+	b := bufferMemory
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used, b.limit
+}
+
+// reserve waits until n bytes fit under the cap or ctx is done. A request
+// larger than the whole cap is let through once nothing else is reserved.
+func (b *bufferBudget) reserve(ctx context.Context, n int64) error {
+	for {
+		b.mu.Lock()
+		if b.limit == 0 || b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+// charge counts n bytes without waiting.
+func (b *bufferBudget) charge(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+func (b *bufferBudget) release(n int64) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	if b.used < 0 {
+		b.used = 0
+	}
+	b.signalLocked()
+	b.mu.Unlock()
+}
+
+func (b *bufferBudget) signalLocked() {
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrCancelled = errors.New("download cancelled")
+
+// CancelBySource skips every queued or held item from source and cancels the
+// ones currently downloading. It returns how many items were affected.
+func CancelBySource(source string) int {
+	return CancelMatching(func(item DownloadItem) bool {
+		return item.Source == source
+	}, true)
+}
+
+// CancelByAlbum skips every queued or held item from albumName and cancels
+// the ones currently downloading. It returns how many items were affected.
+func CancelByAlbum(albumName string) int {
+	return CancelMatching(func(item DownloadItem) bool {
+		return item.AlbumName == albumName
+	}, true)
+}
+
+// CancelMatching skips the queued and held items for which match returns
+// true. With includeActive, matching downloads are cancelled too: their item
+// context is cancelled with ErrCancelled, which aborts their requests and
+// their next write. Any deadline set on them is left in place. It returns
+// how many items were affected.
+func CancelMatching(match func(item DownloadItem) bool, includeActive bool) int {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	cancelled := 0
+	for i := range downloadQueue {
+		item := &downloadQueue[i]
+		switch item.Status {
+		case StatusQueued, StatusHeld:
+		case StatusDownloading:
+			if !includeActive {
+				continue
+			}
+		default:
+			continue
+		}
+		if !match(*item) {
+			continue
+		}
+
+		if item.Status == StatusDownloading {
+			cancelItemAttempt(item.ID, ErrCancelled)
+		} else {
+			recordQueueWait(item)
+		}
+		item.Status = StatusSkipped
+		item.EndTime = time.Now().Unix()
+		item.Speed = 0
+		item.ErrorMessage = "Cancelled"
+		publishQueueEvent(EventItemSkipped, *item)
+		cancelled++
+	}
+
+	if cancelled > 0 {
+		evictHistoryLocked()
+	}
+	return cancelled
+}
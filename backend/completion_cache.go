@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type recentCompletion struct {
+	at   time.Time
+	path string
+}
+
+var (
+	skipCompletedWithin   atomic.Int64
+	recentCompletions     = make(map[string]recentCompletion)
+	recentCompletionsLock sync.Mutex
+)
+
+func SetSkipIfCompletedWithin(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	skipCompletedWithin.Store(int64(d))
+}
+
+func recordCompletion(spotifyID, path string) {
+	if spotifyID == "" {
+		return
+	}
+
+	recentCompletionsLock.Lock()
+	recentCompletions[spotifyID] = recentCompletion{at: time.Now(), path: path}
+	recentCompletionsLock.Unlock()
+}
+
+func recentCompletionPath(spotifyID string) (string, bool) {
+	window := time.Duration(skipCompletedWithin.Load())
+	if window == 0 || spotifyID == "" {
+		return "", false
+	}
+
+	recentCompletionsLock.Lock()
+	defer recentCompletionsLock.Unlock()
+
+	cutoff := time.Now().Add(-window)
+	for id, completion := range recentCompletions {
+		if completion.at.Before(cutoff) {
+			delete(recentCompletions, id)
+		}
+	}
+
+	completion, ok := recentCompletions[spotifyID]
+	return completion.path, ok
+}
+
+func resetCompletionCache() {
+	recentCompletionsLock.Lock()
+	recentCompletions = make(map[string]recentCompletion)
+	recentCompletionsLock.Unlock()
+}
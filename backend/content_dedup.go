@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var ErrDuplicateContent = errors.New("another item already downloaded this content")
+
+var contentDedup atomic.Bool
+
+// SetContentDedup skips an item once its source is resolved if another item
+// has already completed from the same content, catching duplicates that come
+// from different Spotify IDs. Content is identified by the fingerprint set
+// with SetItemFingerprint or, failing that, the resolved source URL. It is
+// off by default.
+func SetContentDedup(enabled bool) {
+	contentDedup.Store(enabled)
+}
+
+// SetItemFingerprint sets a content fingerprint, such as an audio hash or a
+// provider track ID, used instead of the source URL by SetContentDedup.
+func SetItemFingerprint(id, fingerprint string) {
+	updateItemTiming(id, func(item *DownloadItem) { item.Fingerprint = fingerprint })
+}
+
+func contentKey(item DownloadItem) string {
+	if item.Fingerprint != "" {
+		return "fp:" + item.Fingerprint
+	}
+	if item.SourceURL != "" {
+		return "url:" + item.SourceURL
+	}
+	return ""
+}
+
+// skipDuplicateContent marks the item skipped when a different item has
+// already completed with the same content key, and returns
+// ErrDuplicateContent in that case.
+func skipDuplicateContent(id string) error {
+	if !contentDedup.Load() {
+		return nil
+	}
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		return nil
+	}
+	item := downloadQueue[index]
+	key := contentKey(item)
+	if key == "" {
+		return nil
+	}
+
+	for _, other := range downloadQueue {
+		if other.ID == id || other.Status != StatusCompleted || contentKey(other) != key {
+			continue
+		}
+		skipDownloadItemLocked(id, other.FilePath, "Duplicate content")
+		evictHistoryLocked()
+		fmt.Printf("Skipping %s - %s: same content as %s - %s\n", item.TrackName, item.ArtistName, other.TrackName, other.ArtistName)
+		return ErrDuplicateContent
+	}
+	return nil
+}
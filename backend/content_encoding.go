@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type wireCounter struct {
+	reader io.Reader
+	pw     *ProgressWriter
+}
+
+func (c *wireCounter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.pw.wire += int64(n)
+	return n, err
+}
+
+type lazyDecoder struct {
+	source io.Reader
+	open   func(io.Reader) (io.Reader, error)
+	reader io.Reader
+	err    error
+}
+
+func (r *lazyDecoder) Read(p []byte) (int, error) {
+	if r.reader == nil && r.err == nil {
+		r.reader, r.err = r.open(r.source)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.reader.Read(p)
+}
+
+// ResponseBody returns the body of resp, decoded according to its
+// Content-Encoding, while counting the bytes read off the wire. Speed is then
+// reported from wire bytes and progress from decoded bytes. The expected size
+// is taken from Content-Length only when the body is not encoded.
+func (pw *ProgressWriter) ResponseBody(resp *http.Response) io.Reader {
+	body := io.Reader(&wireCounter{reader: resp.Body, pw: pw})
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return &lazyDecoder{source: body, open: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		}}
+	case "deflate":
+		return &lazyDecoder{source: body, open: func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		}}
+	default:
+		pw.SetExpectedSize(resp.ContentLength)
+		return body
+	}
+}
+
+func (pw *ProgressWriter) GetWireBytes() int64 {
+	if pw.wire > 0 {
+		return pw.wire
+	}
+	return pw.total
+}
@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetCopyBufferSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "default", size: 0},
+		{name: "minimum", size: minCopyBufferSize},
+		{name: "1 MiB", size: 1 << 20},
+		{name: "maximum", size: maxCopyBufferSize},
+		{name: "below minimum", size: minCopyBufferSize - 1, wantErr: true},
+		{name: "above maximum", size: maxCopyBufferSize + 1, wantErr: true},
+		{name: "negative", size: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { SetCopyBufferSize(0) })
+			SetCopyBufferSize(4096)
+
+			err := SetCopyBufferSize(tt.size)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("SetCopyBufferSize(%d) error = %v, want error %v", tt.size, err, tt.wantErr)
+			}
+			want := int64(tt.size)
+			if tt.wantErr {
+				want = 4096
+			}
+			if got := copyBufferSize.Load(); got != want {
+				t.Errorf("copy buffer size = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+// zeroReader yields size zero bytes and records the largest read requested.
+type zeroReader struct {
+	size    int64
+	largest int
+}
+
+func (r *zeroReader) Read(p []byte) (int, error) {
+	if r.size <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.largest {
+		r.largest = len(p)
+	}
+	n := int64(len(p))
+	if n > r.size {
+		n = r.size
+	}
+	clear(p[:n])
+	r.size -= n
+	return int(n), nil
+}
+
+func quietProgress(tb testing.TB) {
+	suppressInlineOutput.Store(true)
+	tb.Cleanup(func() {
+		suppressInlineOutput.Store(false)
+		resetDownloadSpeed()
+	})
+}
+
+func TestProgressWriterReadFromBufferSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		{name: "default", size: 0, want: defaultCopyBufferSize},
+		{name: "1 MiB", size: 1 << 20, want: 1 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quietProgress(t)
+			if err := SetCopyBufferSize(tt.size); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { SetCopyBufferSize(0) })
+
+			src := &zeroReader{size: 4 << 20}
+			pw := NewProgressWriter(io.Discard)
+			n, err := io.Copy(pw, src)
+			if err != nil || n != 4<<20 {
+				t.Fatalf("copied %d bytes, err %v", n, err)
+			}
+			if src.largest != tt.want {
+				t.Errorf("largest read = %d, want %d", src.largest, tt.want)
+			}
+			if used, _ := GetBufferMemory(); used != 0 {
+				t.Errorf("%d bytes of buffer memory still held", used)
+			}
+		})
+	}
+}
+
+func TestProgressWriterReadFromCancelledWhileWaiting(t *testing.T) {
+	resetQueueState(t)
+	quietProgress(t)
+	SetMaxBufferMemory(minCopyBufferSize)
+	t.Cleanup(func() { SetMaxBufferMemory(0) })
+
+	// Hold the whole budget so the writer has to wait for memory.
+	_, release, err := acquireCopyBuffer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	startItem(t, "item")
+	pw := NewProgressWriterWithID(io.Discard, "item")
+	done := make(chan error, 1)
+	go func() {
+		_, err := pw.ReadFrom(&zeroReader{size: 1 << 20})
+		done <- err
+	}()
+
+	if n := CancelMatching(func(item DownloadItem) bool { return item.ID == "item" }, true); n != 1 {
+		t.Fatalf("cancelled %d items, want 1", n)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReadFrom error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReadFrom still waiting for buffer memory after the item was cancelled")
+	}
+}
+
+// BenchmarkProgressWriterCopy streams a file so that every read is a system
+// call, which is the overhead a larger buffer saves.
+func BenchmarkProgressWriterCopy(b *testing.B) {
+	const streamSize = 32 << 20
+	path := filepath.Join(b.TempDir(), "stream")
+	if err := os.WriteFile(path, make([]byte, streamSize), 0644); err != nil {
+		b.Fatal(err)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer src.Close()
+
+	for _, size := range []int{32 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			quietProgress(b)
+			if err := SetCopyBufferSize(size); err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { SetCopyBufferSize(0) })
+
+			b.SetBytes(streamSize)
+			for n := 0; n < b.N; n++ {
+				if _, err := src.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				// Hide the file's WriteTo so the copy goes through ReadFrom.
+				pw := NewProgressWriter(io.Discard)
+				if _, err := io.Copy(pw, struct{ io.Reader }{src}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+// itemAttempt is the context of an item's current download attempt. It is
+// cancelled with ErrCancelled or ErrDeadlineExceeded as its cause.
+type itemAttempt struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+type itemDeadline struct {
+	timer *time.Timer
+}
+
+// itemAttempts and itemDeadlines are kept apart so cancelling an attempt does
+// not drop the item's deadline, and a new deadline does not abort a running
+// attempt.
+var (
+	itemAttempts     = make(map[string]*itemAttempt)
+	itemDeadlines    = make(map[string]*itemDeadline)
+	itemContextsLock sync.Mutex
+)
+
+// SetItemDeadline fails the item with "deadline exceeded" if it has not
+// finished by t, regardless of progress. A running transfer is aborted, even
+// when its connection has stalled. Setting a new deadline replaces the
+// previous one.
+func SetItemDeadline(id string, t time.Time) error {
+	downloadQueueLock.Lock()
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		downloadQueueLock.Unlock()
+		return fmt.Errorf("item %s not found", id)
+	}
+	if isTerminalStatus(downloadQueue[index].Status) {
+		downloadQueueLock.Unlock()
+		return fmt.Errorf("item %s has already finished", id)
+	}
+	downloadQueue[index].Deadline = t.UnixMilli()
+	downloadQueueLock.Unlock()
+
+	deadline := &itemDeadline{}
+
+	itemContextsLock.Lock()
+	if previous, ok := itemDeadlines[id]; ok {
+		previous.timer.Stop()
+	}
+	itemDeadlines[id] = deadline
+	deadline.timer = time.AfterFunc(time.Until(t), func() {
+		expireItemDeadline(id, deadline)
+	})
+	itemContextsLock.Unlock()
+	return nil
+}
+
+// ItemContext returns the context of the item's current download attempt. It
+// is cancelled when the item's deadline passes or the item is cancelled, and
+// a fresh one is used each time the item starts.
+func ItemContext(id string) context.Context {
+	if id == "" {
+		return context.Background()
+	}
+
+	itemContextsLock.Lock()
+	defer itemContextsLock.Unlock()
+	return itemAttemptLocked(id).ctx
+}
+
+func itemAttemptLocked(id string) *itemAttempt {
+	attempt, ok := itemAttempts[id]
+	if !ok {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		attempt = &itemAttempt{ctx: ctx, cancel: cancel}
+		itemAttempts[id] = attempt
+	}
+	return attempt
+}
+
+// newItemRequest builds a request bound to the item's context, so a deadline
+// or cancellation aborts it even while the connection is stalled.
+func newItemRequest(itemID, method, url string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ItemContext(itemID), method, url, body)
+}
+
+// cancelItemAttempt aborts the item's current attempt with cause. Requests
+// bound to it fail and its ProgressWriter returns cause from the next write.
+func cancelItemAttempt(id string, cause error) {
+	itemContextsLock.Lock()
+	itemAttemptLocked(id).cancel(cause)
+	itemContextsLock.Unlock()
+}
+
+// itemStopCause returns why the item's current attempt was aborted, or nil.
+func itemStopCause(id string) error {
+	itemContextsLock.Lock()
+	defer itemContextsLock.Unlock()
+
+	attempt, ok := itemAttempts[id]
+	if !ok {
+		return nil
+	}
+	return context.Cause(attempt.ctx)
+}
+
+// withStopCause makes sure a failure caused by an aborted attempt carries the
+// reason, since a request cut off by its context only reports
+// context.Canceled.
+func withStopCause(id string, err error) error {
+	cause := itemStopCause(id)
+	if cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	if errors.Is(cause, ErrDeadlineExceeded) {
+		return newDownloadError(id, ErrorCategoryDeadline, fmt.Errorf("%w: %v", cause, err), 0)
+	}
+	return fmt.Errorf("%w: %v", cause, err)
+}
+
+// resetItemAttempt drops an aborted attempt when the item starts again, so
+// the new attempt gets a fresh context.
+func resetItemAttempt(id string) {
+	itemContextsLock.Lock()
+	if attempt, ok := itemAttempts[id]; ok && attempt.ctx.Err() != nil {
+		delete(itemAttempts, id)
+	}
+	itemContextsLock.Unlock()
+}
+
+// releaseItemContextLocked forgets the attempt and deadline of an item that
+// has finished or been removed. A writer still running for it keeps the
+// context it was created with.
+func releaseItemContextLocked(id string) {
+	if attempt, ok := itemAttempts[id]; ok {
+		attempt.cancel(nil)
+		delete(itemAttempts, id)
+	}
+	if deadline, ok := itemDeadlines[id]; ok {
+		deadline.timer.Stop()
+		delete(itemDeadlines, id)
+	}
+}
+
+func expireItemDeadline(id string, deadline *itemDeadline) {
+	itemContextsLock.Lock()
+	if itemDeadlines[id] != deadline {
+		itemContextsLock.Unlock()
+		return
+	}
+	delete(itemDeadlines, id)
+	if attempt, ok := itemAttempts[id]; ok {
+		attempt.cancel(ErrDeadlineExceeded)
+	}
+	itemContextsLock.Unlock()
+
+	downloadQueueLock.RLock()
+	index := indexOfItemLocked(id)
+	finished := index < 0 || isTerminalStatus(downloadQueue[index].Status)
+	downloadQueueLock.RUnlock()
+
+	if !finished {
+		FailDownloadItemErr(id, newDownloadError(id, ErrorCategoryDeadline, ErrDeadlineExceeded, 0))
+	}
+}
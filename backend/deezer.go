@@ -13,7 +13,9 @@ import (
 )
 
 type DeezerDownloader struct {
-	client *http.Client
+	client     *http.Client
+	itemID     string
+	outputPath string
 }
 
 func NewDeezerDownloader() *DeezerDownloader {
@@ -24,6 +26,17 @@ func NewDeezerDownloader() *DeezerDownloader {
 	}
 }
 
+func (d *DeezerDownloader) SetItemID(itemID string) {
+	d.itemID = itemID
+}
+
+// SetOutputPath names the downloaded file after path, the one planned for the
+// item, instead of the name built from the filename format. The extension of
+// the delivered file is kept.
+func (d *DeezerDownloader) SetOutputPath(path string) {
+	d.outputPath = path
+}
+
 type YoinkifyRequest struct {
 	URL         string `json:"url"`
 	Format      string `json:"format"`
@@ -44,39 +57,47 @@ func (d *DeezerDownloader) DownloadFromYoinkify(spotifyURL, outputDir string) (s
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	req, err := newItemDownloadRequest(d.itemID, "POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/145.0.0.0 Safari/537.36")
+	applyItemHeaders(req, d.itemID)
 
 	fmt.Printf("Fetching from Deezer API (Yoinkify)...\n")
 	resp, err := d.client.Do(req)
 	if err != nil {
-		return "", err
+		return "", transferError(d.itemID, err, 0)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Deezer API returned status %d", resp.StatusCode)
+		return "", statusError(d.itemID, resp.StatusCode, fmt.Errorf("Deezer API returned status %d", resp.StatusCode))
 	}
 
 	tempFileName := fmt.Sprintf("deezer_%d.flac", time.Now().UnixNano())
 	filePath := filepath.Join(outputDir, tempFileName)
 
-	out, err := os.Create(filePath)
+	out, target, err := createTempFile(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer out.Close()
 
 	fmt.Printf("Downloading track from Deezer...\n")
-	pw := NewProgressWriter(out)
-	_, err = io.Copy(pw, resp.Body)
+	pw := NewProgressWriterWithID(out, d.itemID)
+	_, err = io.Copy(pw, pw.ResponseBody(resp))
+	if finishErr := pw.Finish(); err == nil {
+		err = finishErr
+	}
+	if err == nil {
+		err = out.Close()
+	}
 	if err != nil {
-		out.Close()
-		os.Remove(filePath)
+		return "", transferError(d.itemID, err, pw.GetTotal())
+	}
+	if err := commitTempFile(d.itemID, target, filePath); err != nil {
 		return "", err
 	}
 
@@ -86,10 +107,8 @@ func (d *DeezerDownloader) DownloadFromYoinkify(spotifyURL, outputDir string) (s
 
 func (d *DeezerDownloader) Download(spotifyID, outputDir, filenameFormat, playlistName, playlistOwner string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate, spotifyCoverURL string, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, embedMaxQualityCover bool, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, useFirstArtistOnly bool, useSingleGenre bool, embedGenre bool) (string, error) {
 
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create output directory: %w", err)
-		}
+	if err := ensureOutputDir(outputDir); err != nil {
+		return "", err
 	}
 
 	if spotifyTrackName != "" && spotifyArtistName != "" {
@@ -100,7 +119,7 @@ func (d *DeezerDownloader) Download(spotifyID, outputDir, filenameFormat, playli
 			filenameAlbumArtist = GetFirstArtist(spotifyAlbumArtist)
 		}
 		expectedFilename := BuildExpectedFilename(spotifyTrackName, filenameArtist, spotifyAlbumName, filenameAlbumArtist, spotifyReleaseDate, filenameFormat, playlistName, playlistOwner, includeTrackNumber, position, spotifyDiscNumber, false)
-		expectedPath := filepath.Join(outputDir, expectedFilename)
+		expectedPath := plannedOutputPath(d.outputPath, filepath.Join(outputDir, expectedFilename))
 
 		if fileInfo, err := os.Stat(expectedPath); err == nil && fileInfo.Size() > 0 {
 			fmt.Printf("File already exists: %s (%.2f MB)\n", expectedPath, float64(fileInfo.Size())/(1024*1024))
@@ -213,7 +232,7 @@ func (d *DeezerDownloader) Download(spotifyID, outputDir, filenameFormat, playli
 
 		ext := ".flac"
 		newFilename = newFilename + ext
-		newFilePath := filepath.Join(outputDir, newFilename)
+		newFilePath := plannedOutputPath(d.outputPath, filepath.Join(outputDir, newFilename))
 
 		if err := os.Rename(filePath, newFilePath); err != nil {
 			fmt.Printf("Warning: Failed to rename file: %v\n", err)
@@ -0,0 +1,163 @@
+package backend
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type DiagnosticCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+type DiagnosticsReport struct {
+	GeneratedAt      int64             `json:"generated_at"`
+	Healthy          bool              `json:"healthy"`
+	Checks           []DiagnosticCheck `json:"checks"`
+	Timings          []ItemTiming      `json:"timings"`
+	ConcurrentWrites int               `json:"concurrent_writes"`
+	BufferMemory     int64             `json:"buffer_memory"`
+	MaxBufferMemory  int64             `json:"max_buffer_memory"`
+}
+
+func SelfCheck() DiagnosticsReport {
+	downloadQueueLock.RLock()
+	var orphaned []string
+	downloading := 0
+	ids := make(map[string]DownloadStatus, len(downloadQueue))
+	for _, item := range downloadQueue {
+		ids[item.ID] = item.Status
+		if item.Status == StatusDownloading {
+			downloading++
+			if !hasActiveWorker(item.ID) {
+				orphaned = append(orphaned, item.ID)
+			}
+		}
+	}
+	counted := countedDownloadIDs()
+	active := atomic.LoadInt64(&activeDownloads)
+	downloadQueueLock.RUnlock()
+
+	current := GetCurrentItemID()
+
+	var stale []string
+	for _, id := range activeWorkerIDs() {
+		if ids[id] != StatusDownloading {
+			stale = append(stale, id)
+		}
+	}
+
+	// The activeDownloads counter also includes transfers outside the queue,
+	// so it may exceed the number of downloading items but not fall short of
+	// it, and every item it includes must still be downloading.
+	var staleCounted []string
+	for _, id := range counted {
+		if ids[id] != StatusDownloading {
+			staleCounted = append(staleCounted, id)
+		}
+	}
+
+	checks := []DiagnosticCheck{
+		{
+			Name:   "current_item_present",
+			Passed: current == "" || ids[current] != "",
+		},
+		{
+			Name:    "orphaned_downloads",
+			Passed:  len(orphaned) == 0,
+			Message: fmt.Sprintf("%d downloading items have no active worker %v", len(orphaned), orphaned),
+		},
+		{
+			Name:    "stale_workers",
+			Passed:  len(stale) == 0,
+			Message: fmt.Sprintf("%d active workers reference items that are not downloading %v", len(stale), stale),
+		},
+		{
+			Name:    "active_downloads_counter",
+			Passed:  active >= int64(downloading) && len(staleCounted) == 0,
+			Message: fmt.Sprintf("counter is %d for %d downloading items; %d counted items are not downloading %v", active, downloading, len(staleCounted), staleCounted),
+		},
+	}
+
+	if current == "" {
+		checks[0].Message = "no current item"
+	} else if checks[0].Passed {
+		checks[0].Message = fmt.Sprintf("current item %s is in the queue", current)
+	} else {
+		checks[0].Message = fmt.Sprintf("current item %s is not in the queue", current)
+	}
+
+	healthy := true
+	for _, check := range checks {
+		if !check.Passed {
+			healthy = false
+			break
+		}
+	}
+
+	bufferUsed, bufferLimit := GetBufferMemory()
+	return DiagnosticsReport{
+		GeneratedAt:      time.Now().Unix(),
+		Healthy:          healthy,
+		Checks:           checks,
+		Timings:          collectItemTimings(),
+		ConcurrentWrites: GetConcurrentWrites(),
+		BufferMemory:     bufferUsed,
+		MaxBufferMemory:  bufferLimit,
+	}
+}
+
+func GetLongestRunningActive() (DownloadItem, time.Duration, bool) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	oldest := -1
+	for i, item := range downloadQueue {
+		if item.Status != StatusDownloading || item.StartedAtMillis == 0 {
+			continue
+		}
+		if oldest < 0 || item.StartedAtMillis < downloadQueue[oldest].StartedAtMillis {
+			oldest = i
+		}
+	}
+	if oldest < 0 {
+		return DownloadItem{}, 0, false
+	}
+
+	item := downloadQueue[oldest]
+	running := time.Duration(getCurrentTimeMillis()-item.StartedAtMillis) * time.Millisecond
+	return item, running, true
+}
+
+// GetLastCompleted returns the completed item with the latest end time, or
+// false when nothing in the queue has completed.
+func GetLastCompleted() (DownloadItem, bool) {
+	return latestFinished(StatusCompleted)
+}
+
+// GetLastFailed returns the failed item with the latest end time, or false
+// when nothing in the queue has failed.
+func GetLastFailed() (DownloadItem, bool) {
+	return latestFinished(StatusFailed)
+}
+
+func latestFinished(status DownloadStatus) (DownloadItem, bool) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	latest := -1
+	for i, item := range downloadQueue {
+		if item.Status != status {
+			continue
+		}
+		if latest < 0 || item.EndTime >= downloadQueue[latest].EndTime {
+			latest = i
+		}
+	}
+	if latest < 0 {
+		return DownloadItem{}, false
+	}
+	return downloadQueue[latest], true
+}
@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const writeBufferSize = 1024 * 1024
+
+type writeSlots struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+var diskWrites = newWriteSlots()
+
+func newWriteSlots() *writeSlots {
+	s := &writeSlots{}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *writeSlots) acquire() {
+	s.mu.Lock()
+	for s.limit > 0 && s.active >= s.limit {
+		s.cond.Wait()
+	}
+	s.active++
+	s.mu.Unlock()
+}
+
+func (s *writeSlots) release() {
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+func (s *writeSlots) setLimit(limit int) {
+	s.mu.Lock()
+	s.limit = limit
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *writeSlots) activeCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+var maxConcurrentWrites atomic.Int64
+
+func SetMaxConcurrentWrites(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxConcurrentWrites.Store(int64(n))
+	diskWrites.setLimit(n)
+}
+
+func GetConcurrentWrites() int {
+	return diskWrites.activeCount()
+}
+
+func (pw *ProgressWriter) writeToDisk(p []byte) (int, error) {
+	if maxConcurrentWrites.Load() == 0 && len(pw.buf) == 0 {
+		diskWrites.acquire()
+		defer diskWrites.release()
+		return pw.writer.Write(p)
+	}
+
+	if pw.buf == nil {
+		pw.buf = make([]byte, 0, writeBufferSize)
+		bufferMemory.charge(writeBufferSize)
+	}
+	pw.buf = append(pw.buf, p...)
+	if len(pw.buf) >= writeBufferSize {
+		if err := pw.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (pw *ProgressWriter) flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+
+	diskWrites.acquire()
+	_, err := pw.writer.Write(pw.buf)
+	diskWrites.release()
+
+	pw.buf = pw.buf[:0]
+	return err
+}
+
+// releaseBuffer drops the write buffer and returns its memory.
+func (pw *ProgressWriter) releaseBuffer() {
+	if pw.buf == nil {
+		return
+	}
+	pw.buf = nil
+	bufferMemory.release(writeBufferSize)
+}
@@ -0,0 +1,226 @@
+package backend
+
+import "sync"
+
+const defaultSourceWeight = 1
+
+type DispatchStrategy string
+
+const (
+	DispatchFIFO          DispatchStrategy = "fifo"
+	DispatchLargestFirst  DispatchStrategy = "largest_first"
+	DispatchSmallestFirst DispatchStrategy = "smallest_first"
+	DispatchPriority      DispatchStrategy = "priority"
+)
+
+var (
+	sourceWeights    = make(map[string]int)
+	sourceCredits    = make(map[string]int)
+	dispatchStrategy = DispatchFIFO
+	dispatchLock     sync.Mutex
+)
+
+// SetDispatchStrategy chooses how the next queued item is picked. The default
+// is DispatchFIFO. The size strategies use resolved expected sizes and fall
+// back to FIFO order when no queued item has a known size.
+func SetDispatchStrategy(strategy DispatchStrategy) {
+	dispatchLock.Lock()
+	dispatchStrategy = strategy
+	dispatchLock.Unlock()
+}
+
+func SetSourceWeights(weights map[string]int) {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+
+	sourceWeights = make(map[string]int, len(weights))
+	for source, weight := range weights {
+		if weight > 0 {
+			sourceWeights[source] = weight
+		}
+	}
+	sourceCredits = make(map[string]int)
+}
+
+func sourceWeightLocked(source string) int {
+	if weight, ok := sourceWeights[source]; ok {
+		return weight
+	}
+	return defaultSourceWeight
+}
+
+func SetItemSource(id, source string) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].Source = source
+			return
+		}
+	}
+}
+
+func NextQueuedItem() (DownloadItem, bool) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	index := selectNextLocked(true)
+	if index < 0 {
+		return DownloadItem{}, false
+	}
+	return downloadQueue[index], true
+}
+
+func dispatchCandidatesLocked() []int {
+	var candidates []int
+	for i, item := range downloadQueue {
+		if item.Status == StatusQueued && dispatchAllowed(item.ID) {
+			candidates = append(candidates, i)
+		}
+	}
+	return candidates
+}
+
+func selectNextLocked(commit bool) int {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+
+	credits := sourceCredits
+	if !commit {
+		credits = copyCreditsLocked()
+	}
+	return pickCandidateLocked(dispatchCandidatesLocked(), credits)
+}
+
+func copyCreditsLocked() map[string]int {
+	credits := make(map[string]int, len(sourceCredits))
+	for source, credit := range sourceCredits {
+		credits[source] = credit
+	}
+	return credits
+}
+
+// pickCandidateLocked must be called with both downloadQueueLock and
+// dispatchLock held. It advances credits for the source it picks.
+func pickCandidateLocked(candidates []int, credits map[string]int) int {
+	strategy := dispatchStrategy
+	switch strategy {
+	case DispatchPriority:
+		candidates = highestPriorityLocked(candidates)
+	case DispatchSmallestFirst, DispatchLargestFirst:
+		if index := sizeOrderedLocked(candidates, strategy == DispatchLargestFirst); index >= 0 {
+			return index
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+
+	firstBySource := make(map[string]int)
+	var sources []string
+	for _, index := range candidates {
+		source := downloadQueue[index].Source
+		if _, ok := firstBySource[source]; !ok {
+			firstBySource[source] = index
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 1 {
+		return candidates[0]
+	}
+
+	total := 0
+	best := -1
+	for i, source := range sources {
+		weight := sourceWeightLocked(source)
+		credits[source] += weight
+		total += weight
+		if best == -1 || credits[source] > credits[sources[best]] {
+			best = i
+		}
+	}
+	credits[sources[best]] -= total
+
+	return firstBySource[sources[best]]
+}
+
+func sizeOrderedLocked(candidates []int, largest bool) int {
+	best := -1
+	for _, index := range candidates {
+		size := downloadQueue[index].ExpectedSize
+		if size <= 0 {
+			continue
+		}
+		if best < 0 {
+			best = index
+			continue
+		}
+		bestSize := downloadQueue[best].ExpectedSize
+		if (largest && size > bestSize) || (!largest && size < bestSize) {
+			best = index
+		}
+	}
+	return best
+}
+
+// GetDispatchableItems lists the queued items that would start right now, in
+// the order the dispatcher would start them. It is empty while the queue is
+// paused and limited by the free SetMaxConcurrentDownloads slots.
+func GetDispatchableItems() []DownloadItem {
+	if queuePaused.Load() {
+		return []DownloadItem{}
+	}
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	candidates := dispatchCandidatesLocked()
+	slots := len(candidates)
+	if limit := int(maxConcurrentDownloads.Load()); limit > 0 {
+		slots = limit - downloadingCountLocked()
+	}
+
+	return projectDispatchOrderLocked(candidates, slots)
+}
+
+// PeekNext returns up to n queued items in the order the dispatcher will start
+// them. Unlike GetDispatchableItems it ignores the pause state and the
+// concurrency limit, so it also shows items that are only waiting for a free
+// slot. Held items are left out.
+func PeekNext(n int) []DownloadItem {
+	if n <= 0 {
+		return []DownloadItem{}
+	}
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	return projectDispatchOrderLocked(dispatchCandidatesLocked(), n)
+}
+
+// projectDispatchOrderLocked simulates up to limit picks on a copy of the
+// source credits, leaving the dispatcher's state untouched.
+func projectDispatchOrderLocked(candidates []int, limit int) []DownloadItem {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+
+	credits := copyCreditsLocked()
+	items := []DownloadItem{}
+	for len(items) < limit && len(candidates) > 0 {
+		index := pickCandidateLocked(candidates, credits)
+		if index < 0 {
+			break
+		}
+		items = append(items, downloadQueue[index])
+
+		remaining := make([]int, 0, len(candidates)-1)
+		for _, candidate := range candidates {
+			if candidate != index {
+				remaining = append(remaining, candidate)
+			}
+		}
+		candidates = remaining
+	}
+	return items
+}
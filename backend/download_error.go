@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"sync"
+)
+
+type ErrorCategory string
+
+const (
+	ErrorCategoryNetwork    ErrorCategory = "network"
+	ErrorCategoryTimeout    ErrorCategory = "timeout"
+	ErrorCategoryHTTP       ErrorCategory = "http"
+	ErrorCategoryNotFound   ErrorCategory = "not_found"
+	ErrorCategoryAuth       ErrorCategory = "auth"
+	ErrorCategoryFilesystem ErrorCategory = "filesystem"
+	ErrorCategoryDeadline   ErrorCategory = "deadline"
+	ErrorCategoryDisk       ErrorCategory = "disk"
+	ErrorCategoryUnknown    ErrorCategory = "unknown"
+)
+
+type DownloadError struct {
+	ItemID           string
+	Category         ErrorCategory
+	Err              error
+	Retryable        bool
+	BytesTransferred int64
+	HTTPStatus       int
+}
+
+func (e *DownloadError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s error", e.Category)
+	}
+	return e.Err.Error()
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+func newDownloadError(itemID string, category ErrorCategory, err error, transferred int64) *DownloadError {
+	return &DownloadError{
+		ItemID:           itemID,
+		Category:         category,
+		Err:              err,
+		Retryable:        isRetryableCategory(category),
+		BytesTransferred: transferred,
+	}
+}
+
+func isRetryableCategory(category ErrorCategory) bool {
+	switch category {
+	case ErrorCategoryNetwork, ErrorCategoryTimeout:
+		return true
+	}
+	return false
+}
+
+func transferError(itemID string, err error, transferred int64) *DownloadError {
+	return newDownloadError(itemID, classifyError(err), err, transferred)
+}
+
+func statusError(itemID string, status int, err error) *DownloadError {
+	category := ErrorCategoryHTTP
+	switch {
+	case status == http.StatusNotFound || status == http.StatusGone:
+		category = ErrorCategoryNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		category = ErrorCategoryAuth
+	}
+
+	downloadErr := newDownloadError(itemID, category, err, 0)
+	downloadErr.Retryable = category == ErrorCategoryHTTP && isTransientStatus(status)
+	downloadErr.HTTPStatus = status
+	return downloadErr
+}
+
+// isTransientStatus reports whether a response status is worth retrying: a
+// server error or a rate limit.
+func isTransientStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// HTTPStatusOf returns the HTTP status carried by err, or 0 when the failure
+// was not an HTTP error.
+func HTTPStatusOf(err error) int {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.HTTPStatus
+	}
+	return 0
+}
+
+// SetItemHTTPStatus records the HTTP status of the response that is about to
+// fail the item. A later FailDownloadItem treats the failure as that HTTP
+// error for classification and retries and mentions the status in the error
+// message. The status is cleared when the item starts again.
+func SetItemHTTPStatus(id string, code int) {
+	updateItemTiming(id, func(item *DownloadItem) { item.HTTPStatus = code })
+}
+
+func classifyError(err error) ErrorCategory {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorCategoryTimeout
+		}
+		return ErrorCategoryNetwork
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ErrorCategoryFilesystem
+	}
+
+	// A body that ends early is a dropped connection, not a bad response.
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorCategoryNetwork
+	}
+	return ErrorCategoryUnknown
+}
+
+type RetryPredicate func(err error, attempt int) bool
+
+var (
+	retryPredicate     RetryPredicate = DefaultRetryPredicate
+	retryPredicateLock sync.RWMutex
+)
+
+// SetRetryPredicate decides whether a failed item is requeued while retries
+// remain. attempt is the number of the retry that would run. The predicate is
+// called with the queue locked and must not call back into the queue. Passing
+// nil restores DefaultRetryPredicate.
+func SetRetryPredicate(predicate func(err error, attempt int) bool) {
+	retryPredicateLock.Lock()
+	defer retryPredicateLock.Unlock()
+
+	if predicate == nil {
+		retryPredicate = DefaultRetryPredicate
+		return
+	}
+	retryPredicate = predicate
+}
+
+// DefaultRetryPredicate retries network and timeout errors and HTTP 5xx and
+// 429 responses. Everything else, including errors it cannot classify, fails
+// the item.
+func DefaultRetryPredicate(err error, attempt int) bool {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Retryable
+	}
+	return isRetryableCategory(classifyError(err))
+}
+
+func shouldRetry(err error, attempt int) bool {
+	retryPredicateLock.RLock()
+	predicate := retryPredicate
+	retryPredicateLock.RUnlock()
+	return predicate(err, attempt)
+}
@@ -0,0 +1,57 @@
+package backend
+
+import "time"
+
+const speedSmoothing = 0.2
+
+func resetAverageSpeed() {
+	speedLock.Lock()
+	averageSpeed = 0
+	speedLock.Unlock()
+}
+
+// GetEstimatedCompletionTime returns when the remaining queue is expected to
+// finish. Items without a known size are estimated from the average size of
+// completed items. The boolean is false when nothing is left or no speed has
+// been observed yet.
+func GetEstimatedCompletionTime() (time.Time, bool) {
+	downloadQueueLock.RLock()
+	var remaining, completedBytes float64
+	var pending, unknown, completedCount int
+	for _, item := range downloadQueue {
+		switch item.Status {
+		case StatusCompleted:
+			completedBytes += item.TotalSize
+			completedCount++
+		case StatusQueued, StatusDownloading:
+			pending++
+			if item.ExpectedSize <= 0 {
+				unknown++
+				continue
+			}
+			left := float64(item.ExpectedSize)/bytesPerMiB - item.Progress
+			if left > 0 {
+				remaining += left
+			}
+		}
+	}
+	downloadQueueLock.RUnlock()
+
+	if pending == 0 {
+		return time.Time{}, false
+	}
+	if unknown > 0 && completedCount > 0 {
+		remaining += float64(unknown) * completedBytes / float64(completedCount)
+	}
+
+	speedLock.RLock()
+	speed := averageSpeed
+	speedLock.RUnlock()
+
+	if speed <= 0 || remaining <= 0 {
+		return time.Time{}, false
+	}
+
+	seconds := remaining / speed
+	return time.Now().Add(time.Duration(seconds * float64(time.Second))), true
+}
@@ -0,0 +1,362 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type QueueEventType string
+
+const (
+	EventItemAdded      QueueEventType = "added"
+	EventItemStarted    QueueEventType = "started"
+	EventItemProgress   QueueEventType = "progress"
+	EventItemCompleted  QueueEventType = "completed"
+	EventItemFailed     QueueEventType = "failed"
+	EventItemSkipped    QueueEventType = "skipped"
+	EventItemRequeued   QueueEventType = "requeued"
+	EventItemRemoved    QueueEventType = "removed"
+	EventItemHeld       QueueEventType = "held"
+	EventItemReleased   QueueEventType = "released"
+	EventItemUpdated    QueueEventType = "updated"
+	EventQueueCleared   QueueEventType = "cleared"
+	EventQueueReordered QueueEventType = "reordered"
+	EventQueueRestored  QueueEventType = "restored"
+)
+
+// QueueEvent is a lightweight change notification carrying the item's new
+// status and progress. Item is only set for subscribers registered with
+// SubscribeQueueEventsWithItems; others can call GetDownloadQueue when they
+// need the full view.
+type QueueEvent struct {
+	Type      QueueEventType `json:"type"`
+	ItemID    string         `json:"item_id"`
+	Status    DownloadStatus `json:"status,omitempty"`
+	Progress  float64        `json:"progress"`
+	Speed     float64        `json:"speed"`
+	Item      *DownloadItem  `json:"item,omitempty"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+const defaultEventBuffer = 64
+
+type eventSubscriber struct {
+	ch        chan QueueEvent
+	withItems bool
+}
+
+var (
+	eventSubscribers     = make(map[int]eventSubscriber)
+	eventSubscribersLock sync.RWMutex
+	eventSubscriberCount atomic.Int64
+	itemSubscriberCount  atomic.Int64
+	nextSubscriberID     int
+)
+
+// SubscribeQueueEvents delivers lightweight change notifications whose cost
+// does not depend on the size of the queue or of the item.
+func SubscribeQueueEvents() (<-chan QueueEvent, func()) {
+	return subscribeQueueEvents(false)
+}
+
+// SubscribeQueueEventsWithItems also attaches a copy of the affected item to
+// each event. The copy is shared between subscribers and must not be
+// modified.
+func SubscribeQueueEventsWithItems() (<-chan QueueEvent, func()) {
+	return subscribeQueueEvents(true)
+}
+
+func subscribeQueueEvents(withItems bool) (<-chan QueueEvent, func()) {
+	ch := make(chan QueueEvent, defaultEventBuffer)
+
+	eventSubscribersLock.Lock()
+	id := nextSubscriberID
+	nextSubscriberID++
+	eventSubscribers[id] = eventSubscriber{ch: ch, withItems: withItems}
+	eventSubscriberCount.Add(1)
+	if withItems {
+		itemSubscriberCount.Add(1)
+	}
+	eventSubscribersLock.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			eventSubscribersLock.Lock()
+			delete(eventSubscribers, id)
+			eventSubscriberCount.Add(-1)
+			if withItems {
+				itemSubscriberCount.Add(-1)
+			}
+			eventSubscribersLock.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// pendingEvent is a queue change waiting to be logged and delivered.
+type pendingEvent struct {
+	eventType QueueEventType
+	item      DownloadItem
+	timestamp int64
+	sequence  uint64
+	gone      []string
+}
+
+var (
+	pendingEvents      []pendingEvent
+	pendingEventsLock  sync.Mutex
+	eventSignal        = make(chan struct{}, 1)
+	eventDispatcherRun sync.Once
+)
+
+// publishQueueEvent must be called with downloadQueueLock held. Only the
+// bookkeeping that has to see the queue as it is now runs here. Logging,
+// auto-save and delivery to subscribers happen on a single goroutine, in
+// order, so the lock is never held across file I/O or channel sends.
+func publishQueueEvent(eventType QueueEventType, item DownloadItem) {
+	invalidateUndoLocked(eventType)
+	recordStateTransitionLocked(eventType, &item)
+	trackStatusChangeLocked(eventType, item)
+	countStatusTransitionLocked(eventType, item)
+	releaseItemStateLocked(eventType, item)
+
+	eventSequence++
+	if !hasEventConsumers() {
+		return
+	}
+
+	var gone []string
+	if item.ID == "" {
+		gone = goneItemSubscriptionsLocked()
+	}
+	pendingEventsLock.Lock()
+	pendingEvents = append(pendingEvents, pendingEvent{
+		eventType: eventType,
+		item:      item,
+		timestamp: time.Now().UnixMilli(),
+		sequence:  eventSequence,
+		gone:      gone,
+	})
+	pendingEventsLock.Unlock()
+
+	eventDispatcherRun.Do(func() {
+		go dispatchQueueEvents()
+	})
+	select {
+	case eventSignal <- struct{}{}:
+	default:
+	}
+}
+
+func hasEventConsumers() bool {
+	return eventSubscriberCount.Load() > 0 ||
+		itemSubscriptionCount.Load() > 0 ||
+		queueLogger.Load() != nil ||
+		progressLogOpen.Load() ||
+		activeAutoSaver.Load() != nil
+}
+
+func dispatchQueueEvents() {
+	for range eventSignal {
+		pendingEventsLock.Lock()
+		events := pendingEvents
+		pendingEvents = nil
+		pendingEventsLock.Unlock()
+
+		for _, pending := range events {
+			deliverQueueEvent(pending)
+		}
+	}
+}
+
+func deliverQueueEvent(pending pendingEvent) {
+	item := pending.item
+	logTransition(pending.eventType, item)
+	logProgressEvent(pending.eventType, item)
+	notifyAutoSave(pending.eventType)
+	deliverItemUpdate(pending)
+
+	if eventSubscriberCount.Load() == 0 {
+		return
+	}
+
+	event := QueueEvent{
+		Type:      pending.eventType,
+		ItemID:    item.ID,
+		Status:    item.Status,
+		Progress:  item.Progress,
+		Speed:     item.Speed,
+		Timestamp: pending.timestamp,
+	}
+	withItem := event
+	if itemSubscriberCount.Load() > 0 {
+		setDisplayProgress(&item)
+		withItem.Item = &item
+	}
+
+	eventSubscribersLock.RLock()
+	defer eventSubscribersLock.RUnlock()
+
+	for _, subscriber := range eventSubscribers {
+		delivered := event
+		if subscriber.withItems {
+			delivered = withItem
+		}
+		select {
+		case subscriber.ch <- delivered:
+		default:
+		}
+	}
+}
+
+type itemSubscription struct {
+	ch    chan DownloadItem
+	since uint64
+}
+
+var (
+	itemSubscriptions     = make(map[string]map[int]*itemSubscription)
+	itemSubscriptionsLock sync.Mutex
+	itemSubscriptionCount atomic.Int64
+	nextItemSubscription  int
+
+	// eventSequence numbers published events so a new item subscription
+	// skips the ones that were already pending when it read the item. It is
+	// guarded by downloadQueueLock.
+	eventSequence uint64
+)
+
+// SubscribeItem delivers the item's current state followed by its updates.
+// The channel is closed, and the subscription dropped, once the item reaches
+// a terminal status or leaves the queue; calling the returned function stops
+// it earlier and may be repeated. Updates are dropped while the channel is
+// full, except the terminal one, which replaces the oldest pending update.
+func SubscribeItem(id string) (<-chan DownloadItem, func()) {
+	updates := make(chan DownloadItem, defaultEventBuffer)
+
+	downloadQueueLock.RLock()
+	index := indexOfItemLocked(id)
+	if index < 0 || isTerminalStatus(downloadQueue[index].Status) {
+		if index >= 0 {
+			current := downloadQueue[index]
+			setDisplayProgress(&current)
+			updates <- current
+		}
+		downloadQueueLock.RUnlock()
+		close(updates)
+		return updates, func() {}
+	}
+	current := downloadQueue[index]
+	setDisplayProgress(&current)
+	updates <- current
+
+	itemSubscriptionsLock.Lock()
+	key := nextItemSubscription
+	nextItemSubscription++
+	if itemSubscriptions[id] == nil {
+		itemSubscriptions[id] = make(map[int]*itemSubscription)
+	}
+	itemSubscriptions[id][key] = &itemSubscription{ch: updates, since: eventSequence}
+	itemSubscriptionCount.Add(1)
+	itemSubscriptionsLock.Unlock()
+	downloadQueueLock.RUnlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			itemSubscriptionsLock.Lock()
+			defer itemSubscriptionsLock.Unlock()
+
+			subscriptions := itemSubscriptions[id]
+			subscription, ok := subscriptions[key]
+			if !ok {
+				return
+			}
+			delete(subscriptions, key)
+			if len(subscriptions) == 0 {
+				delete(itemSubscriptions, id)
+			}
+			itemSubscriptionCount.Add(-1)
+			close(subscription.ch)
+		})
+	}
+	return updates, unsubscribe
+}
+
+// goneItemSubscriptionsLocked lists the subscribed items that are no longer
+// in the queue, for queue-wide events that replace or clear it.
+func goneItemSubscriptionsLocked() []string {
+	if itemSubscriptionCount.Load() == 0 {
+		return nil
+	}
+	itemSubscriptionsLock.Lock()
+	defer itemSubscriptionsLock.Unlock()
+
+	var gone []string
+	for id := range itemSubscriptions {
+		if indexOfItemLocked(id) < 0 {
+			gone = append(gone, id)
+		}
+	}
+	return gone
+}
+
+func deliverItemUpdate(pending pendingEvent) {
+	if itemSubscriptionCount.Load() == 0 {
+		return
+	}
+	itemSubscriptionsLock.Lock()
+	defer itemSubscriptionsLock.Unlock()
+
+	item := pending.item
+	if item.ID == "" {
+		for _, id := range pending.gone {
+			closeItemSubscriptionsLocked(id)
+		}
+		return
+	}
+	subscriptions := itemSubscriptions[item.ID]
+	if len(subscriptions) == 0 {
+		return
+	}
+	if pending.eventType == EventItemRemoved {
+		closeItemSubscriptionsLocked(item.ID)
+		return
+	}
+
+	setDisplayProgress(&item)
+	final := isTerminalStatus(item.Status)
+	for _, subscription := range subscriptions {
+		if pending.sequence <= subscription.since {
+			continue
+		}
+		select {
+		case subscription.ch <- item:
+			continue
+		default:
+		}
+		if final {
+			select {
+			case <-subscription.ch:
+			default:
+			}
+			subscription.ch <- item
+		}
+	}
+	if final {
+		closeItemSubscriptionsLocked(item.ID)
+	}
+}
+
+func closeItemSubscriptionsLocked(id string) {
+	subscriptions := itemSubscriptions[id]
+	for _, subscription := range subscriptions {
+		close(subscription.ch)
+	}
+	itemSubscriptionCount.Add(-int64(len(subscriptions)))
+	delete(itemSubscriptions, id)
+}
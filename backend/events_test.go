@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func pendingEventCount() int {
+	pendingEventsLock.Lock()
+	defer pendingEventsLock.Unlock()
+	return len(pendingEvents)
+}
+
+// nextEvent returns the first event of type want, skipping events left over
+// from earlier changes.
+func nextEvent(t *testing.T, events <-chan QueueEvent, want QueueEventType) QueueEvent {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == want {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", want)
+			return QueueEvent{}
+		}
+	}
+}
+
+func TestPublishWithoutConsumers(t *testing.T) {
+	resetQueueState(t)
+	if hasEventConsumers() {
+		t.Skip("another consumer is registered")
+	}
+
+	before := pendingEventCount()
+	if err := AddToQueue("item", "Track", "Artist", "Album", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingEventCount(); got > before {
+		t.Errorf("publish queued %d events with nobody listening", got-before)
+	}
+
+	events, unsubscribe := SubscribeQueueEvents()
+	defer unsubscribe()
+	if err := StartDownloadItem("item"); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events, EventItemStarted); event.ItemID != "item" {
+		t.Errorf("started event for %q, want item", event.ItemID)
+	}
+}
+
+func TestQueueEventItemAttachment(t *testing.T) {
+	tests := []struct {
+		name      string
+		subscribe func() (<-chan QueueEvent, func())
+		wantItem  bool
+	}{
+		{name: "lightweight", subscribe: SubscribeQueueEvents},
+		{name: "with items", subscribe: SubscribeQueueEventsWithItems, wantItem: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			events, unsubscribe := tt.subscribe()
+			defer unsubscribe()
+
+			if err := AddToQueue("item", "Track", "Artist", "Album", ""); err != nil {
+				t.Fatal(err)
+			}
+			event := nextEvent(t, events, EventItemAdded)
+			if event.ItemID != "item" || event.Status != StatusQueued {
+				t.Errorf("event = %s %s, want item %s", event.ItemID, event.Status, StatusQueued)
+			}
+			if got := event.Item != nil; got != tt.wantItem {
+				t.Fatalf("event carries item = %v, want %v", got, tt.wantItem)
+			}
+			if tt.wantItem && event.Item.TrackName != "Track" {
+				t.Errorf("attached item track = %q, want Track", event.Item.TrackName)
+			}
+		})
+	}
+}
+
+// fillQueue queues n items for the benchmarks.
+func fillQueue(b *testing.B, n int) {
+	b.Helper()
+	ClearAllDownloads()
+	b.Cleanup(ClearAllDownloads)
+	requests := make([]QueueRequest, n)
+	for i := range requests {
+		requests[i] = QueueRequest{ID: fmt.Sprintf("item-%d", i), TrackName: "Track", ArtistName: "Artist"}
+	}
+	if result := AddBatch(requests); len(result.Skipped) > 0 {
+		b.Fatalf("%d items were skipped", len(result.Skipped))
+	}
+}
+
+// drain reads events until unsubscribe closes the channel.
+func drain(events <-chan QueueEvent) {
+	go func() {
+		for range events {
+		}
+	}()
+}
+
+func BenchmarkPublishQueueEvent(b *testing.B) {
+	subscribers := []struct {
+		name      string
+		subscribe func() (<-chan QueueEvent, func())
+	}{
+		{name: "no subscribers"},
+		{name: "subscriber", subscribe: SubscribeQueueEvents},
+		{name: "subscriber with items", subscribe: SubscribeQueueEventsWithItems},
+	}
+
+	// The cost per event should not depend on the size of the queue.
+	for _, size := range []int{100, 10000} {
+		for _, s := range subscribers {
+			b.Run(fmt.Sprintf("%d items/%s", size, s.name), func(b *testing.B) {
+				fillQueue(b, size)
+				if s.subscribe != nil {
+					events, unsubscribe := s.subscribe()
+					drain(events)
+					b.Cleanup(unsubscribe)
+				}
+
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					downloadQueueLock.Lock()
+					publishQueueEvent(EventItemProgress, downloadQueue[n%len(downloadQueue)])
+					downloadQueueLock.Unlock()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	ExportJSON ExportFormat = "json"
+	ExportCSV  ExportFormat = "csv"
+)
+
+type historyExport struct {
+	ExportedAt  int64             `json:"exported_at"`
+	SessionMeta map[string]string `json:"session_meta,omitempty"`
+	Items       []DownloadItem    `json:"items"`
+}
+
+var exportCSVHeader = []string{
+	"id", "track_name", "artist_name", "album_name", "spotify_id", "source", "status",
+	"total_size_mb", "start_time", "end_time", "error_message", "file_path",
+	"resolve_millis", "ttfb_millis", "transfer_millis", "attempt_count", "max_attempts",
+	"http_status",
+}
+
+func ExportHistory(w io.Writer, format ExportFormat) error {
+	downloadQueueLock.RLock()
+	items := make([]DownloadItem, len(downloadQueue))
+	copy(items, downloadQueue)
+	downloadQueueLock.RUnlock()
+
+	return writeExport(w, format, items)
+}
+
+func writeExport(w io.Writer, format ExportFormat, items []DownloadItem) error {
+	switch format {
+	case ExportJSON, "":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(historyExport{
+			ExportedAt:  time.Now().Unix(),
+			SessionMeta: GetSessionMeta(),
+			Items:       items,
+		})
+	case ExportCSV:
+		return writeCSVExport(w, items)
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+func writeCSVExport(w io.Writer, items []DownloadItem) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		record := []string{
+			item.ID,
+			item.TrackName,
+			item.ArtistName,
+			item.AlbumName,
+			item.SpotifyID,
+			item.Source,
+			string(item.Status),
+			strconv.FormatFloat(item.TotalSize, 'f', 2, 64),
+			strconv.FormatInt(item.StartTime, 10),
+			strconv.FormatInt(item.EndTime, 10),
+			item.ErrorMessage,
+			item.FilePath,
+			strconv.FormatInt(item.ResolveMillis, 10),
+			strconv.FormatInt(item.TTFBMillis, 10),
+			strconv.FormatInt(item.TransferMillis, 10),
+			strconv.Itoa(item.AttemptCount),
+			strconv.Itoa(item.MaxAttempts),
+			strconv.Itoa(item.HTTPStatus),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type ExportFilter struct {
+	Format   ExportFormat     `json:"format"`
+	Statuses []DownloadStatus `json:"statuses"`
+	Album    string           `json:"album"`
+	Source   string           `json:"source"`
+	Since    time.Time        `json:"since"`
+	Until    time.Time        `json:"until"`
+	IDs      []string         `json:"ids"`
+}
+
+// ExportFiltered writes the items matching every non-empty field of filter.
+// Dates are compared against the item's end time, or the time it was queued
+// when it has not finished. An empty filter exports everything.
+func ExportFiltered(w io.Writer, filter ExportFilter) error {
+	statuses := make(map[DownloadStatus]bool, len(filter.Statuses))
+	for _, status := range filter.Statuses {
+		statuses[status] = true
+	}
+	ids := make(map[string]bool, len(filter.IDs))
+	for _, id := range filter.IDs {
+		ids[id] = true
+	}
+
+	downloadQueueLock.RLock()
+	var items []DownloadItem
+	for _, item := range downloadQueue {
+		if len(statuses) > 0 && !statuses[item.Status] {
+			continue
+		}
+		if len(ids) > 0 && !ids[item.ID] {
+			continue
+		}
+		if filter.Album != "" && item.AlbumName != filter.Album {
+			continue
+		}
+		if filter.Source != "" && item.Source != filter.Source {
+			continue
+		}
+		if !filter.Since.IsZero() || !filter.Until.IsZero() {
+			at := itemExportTime(item)
+			if !filter.Since.IsZero() && at.Before(filter.Since) {
+				continue
+			}
+			if !filter.Until.IsZero() && at.After(filter.Until) {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	downloadQueueLock.RUnlock()
+
+	if items == nil {
+		items = []DownloadItem{}
+	}
+	return writeExport(w, filter.Format, items)
+}
+
+func itemExportTime(item DownloadItem) time.Time {
+	if item.EndTime > 0 {
+		return time.Unix(item.EndTime, 0)
+	}
+	return time.UnixMilli(item.QueuedAt)
+}
@@ -0,0 +1,178 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxQuarantineReasonLength = 60
+
+type FailureFileMode string
+
+const (
+	FailureFileKeepMode       FailureFileMode = "keep"
+	FailureFileDeleteMode     FailureFileMode = "delete"
+	FailureFileQuarantineMode FailureFileMode = "quarantine"
+)
+
+type FailureFileAction struct {
+	Mode FailureFileMode `json:"mode"`
+	Dir  string          `json:"dir,omitempty"`
+}
+
+var (
+	FailureFileKeep   = FailureFileAction{Mode: FailureFileKeepMode}
+	FailureFileDelete = FailureFileAction{Mode: FailureFileDeleteMode}
+)
+
+func MoveToQuarantine(dir string) FailureFileAction {
+	return FailureFileAction{Mode: FailureFileQuarantineMode, Dir: dir}
+}
+
+var (
+	failureFileAction     = FailureFileKeep
+	failureFileActionLock sync.RWMutex
+)
+
+// SetFailureFileAction decides what happens to the partial file of an item
+// that has permanently failed. The default is FailureFileKeep.
+func SetFailureFileAction(action FailureFileAction) {
+	failureFileActionLock.Lock()
+	failureFileAction = action
+	failureFileActionLock.Unlock()
+}
+
+func SetCleanupPartialOnFailure(enabled bool) {
+	if enabled {
+		SetFailureFileAction(FailureFileDelete)
+	} else {
+		SetFailureFileAction(FailureFileKeep)
+	}
+}
+
+func SetItemPlannedPath(id, path string) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].PlannedPath = path
+			return
+		}
+	}
+}
+
+func partialFilePath(item DownloadItem) string {
+	path := item.FilePath
+	if path == "" {
+		path = item.PlannedPath
+	}
+	if path == "" {
+		return ""
+	}
+	if temp := tempFilePath(path); temp != path {
+		if _, err := os.Stat(temp); err == nil {
+			return temp
+		}
+	}
+	return path
+}
+
+func handleFailedFile(item DownloadItem) {
+	failureFileActionLock.RLock()
+	action := failureFileAction
+	failureFileActionLock.RUnlock()
+
+	if action.Mode != FailureFileDeleteMode && action.Mode != FailureFileQuarantineMode {
+		return
+	}
+
+	path := partialFilePath(item)
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	if action.Mode == FailureFileQuarantineMode {
+		quarantined, err := quarantineFile(path, action.Dir, item.ErrorMessage)
+		if err != nil {
+			fmt.Printf("Warning: Failed to quarantine partial file %s: %v\n", path, err)
+			return
+		}
+		fmt.Printf("Moved partial file after failed download to: %s\n", quarantined)
+		return
+	}
+
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: Failed to remove partial file %s: %v\n", path, err)
+		}
+		return
+	}
+	fmt.Printf("Removed partial file after failed download: %s\n", path)
+}
+
+func quarantineFile(path, dir, reason string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("no quarantine directory configured")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	name := fmt.Sprintf("%s [%s]", base, time.Now().Format("20060102-150405"))
+	if runes := []rune(strings.TrimSpace(reason)); len(runes) > 0 {
+		if len(runes) > maxQuarantineReasonLength {
+			runes = runes[:maxQuarantineReasonLength]
+		}
+		name += " " + strings.TrimSpace(string(runes))
+	}
+	name += ext
+
+	target := filepath.Join(dir, SanitizeFilename(name))
+	if err := moveFile(path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// moveFile renames src to dst, falling back to copying and removing src when
+// dst is on another filesystem.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !isCrossDeviceError(err) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
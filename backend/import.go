@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var importsCountTowardTotal atomic.Bool
+
+// SetImportsCountTowardTotal controls whether MarkImported adds the imported
+// file's size to the session and lifetime download totals. It is off by
+// default, since nothing was transferred.
+func SetImportsCountTowardTotal(enabled bool) {
+	importsCountTowardTotal.Store(enabled)
+}
+
+// MarkImported completes an item with a file that is already on disk, for
+// example one the user added to the library by hand. The item is flagged as
+// Imported and publishes the usual completion event. Items that are actively
+// downloading or already completed are left alone.
+func MarkImported(id, filePath string, size int64) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		return fmt.Errorf("item %s not found", id)
+	}
+
+	item := &downloadQueue[index]
+	if item.Status == StatusCompleted {
+		return fmt.Errorf("item %s is already completed", id)
+	}
+	if item.Status == StatusDownloading && hasActiveWorker(id) {
+		return fmt.Errorf("item %s is downloading", id)
+	}
+
+	sizeMB := float64(size) / bytesPerMiB
+	item.Status = StatusCompleted
+	item.Imported = true
+	item.EndTime = time.Now().Unix()
+	item.FilePath = filePath
+	item.Progress = sizeMB
+	item.TotalSize = sizeMB
+	item.Speed = 0
+	item.ErrorMessage = ""
+	item.ErrorCode = ""
+	if size > 0 && item.ExpectedSize <= 0 {
+		item.ExpectedSize = size
+	}
+
+	if importsCountTowardTotal.Load() {
+		totalDownloadedLock.Lock()
+		totalDownloaded += sizeMB
+		totalDownloadedLock.Unlock()
+		addLifetimeTotal(sizeMB)
+	}
+	recordCompletion(item.SpotifyID, filePath)
+	publishQueueEvent(EventItemCompleted, *item)
+	evictHistoryLocked()
+	return nil
+}
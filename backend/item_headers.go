@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	defaultHeaders     map[string]string
+	defaultHeadersLock sync.RWMutex
+
+	// itemHeaders is kept out of DownloadItem because the values are often
+	// credentials, which must not reach the frontend, events or saved queues.
+	itemHeaders     = make(map[string]map[string]string)
+	itemHeadersLock sync.RWMutex
+)
+
+// SetDefaultHeaders sets headers sent with every download request. Headers
+// set on an item with SetItemHeaders override these by name.
+func SetDefaultHeaders(headers map[string]string) {
+	defaultHeadersLock.Lock()
+	defaultHeaders = copyHeaders(headers)
+	defaultHeadersLock.Unlock()
+}
+
+// SetItemHeaders sets headers the download layer adds to the item's requests,
+// replacing any set before. They are held in memory only: they are not part
+// of the item as returned by the queue, its events, exports or saved queues,
+// and are dropped when the item is removed.
+func SetItemHeaders(id string, headers map[string]string) error {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	if indexOfItemLocked(id) < 0 {
+		return fmt.Errorf("item %s not found", id)
+	}
+
+	itemHeadersLock.Lock()
+	if copied := copyHeaders(headers); copied != nil {
+		itemHeaders[id] = copied
+	} else {
+		delete(itemHeaders, id)
+	}
+	itemHeadersLock.Unlock()
+	return nil
+}
+
+// applyItemHeaders sets the default headers and then the item's own headers
+// on req.
+func applyItemHeaders(req *http.Request, itemID string) {
+	defaultHeadersLock.RLock()
+	for name, value := range defaultHeaders {
+		req.Header.Set(name, value)
+	}
+	defaultHeadersLock.RUnlock()
+
+	if itemID == "" {
+		return
+	}
+
+	itemHeadersLock.RLock()
+	defer itemHeadersLock.RUnlock()
+
+	for name, value := range itemHeaders[itemID] {
+		req.Header.Set(name, value)
+	}
+}
+
+// withItemHeaders wraps a request hook so the configured headers are applied
+// after it.
+func withItemHeaders(itemID string, prepare func(*http.Request)) func(*http.Request) {
+	return func(req *http.Request) {
+		if prepare != nil {
+			prepare(req)
+		}
+		applyItemHeaders(req, itemID)
+	}
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(headers))
+	for name, value := range headers {
+		copied[name] = value
+	}
+	return copied
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+var deterministicIDs atomic.Bool
+
+// SetDeterministicIDs derives the IDs of items queued without one from their
+// Spotify ID and format, falling back to track, artist and album when there
+// is no Spotify ID, instead of generating a random ID. Re-submitting the same
+// track then yields the same ID, which changes what counts as unique: while
+// the earlier item is pending the new one is rejected with ErrDuplicateID
+// whatever the duplicate policy, and once it has finished the new submission
+// replaces it unless the policy is DuplicateSkipAny. Caller-supplied IDs are
+// used as given.
+func SetDeterministicIDs(enabled bool) {
+	deterministicIDs.Store(enabled)
+}
+
+func deterministicItemID(req QueueRequest) string {
+	key := req.SpotifyID
+	if key == "" {
+		key = strings.Join([]string{req.TrackName, req.ArtistName, req.AlbumName}, "\x00")
+	}
+	sum := sha256.Sum256([]byte(key + "\x00" + strings.ToLower(req.Format)))
+	return hex.EncodeToString(sum[:12])
+}
+
+func generateItemID(req QueueRequest, batchTime int64, index int) string {
+	if deterministicIDs.Load() {
+		return deterministicItemID(req)
+	}
+	if batchTime == 0 {
+		return uuid.NewString()
+	}
+	if req.SpotifyID != "" {
+		return fmt.Sprintf("%s-%d-%d", req.SpotifyID, batchTime, index)
+	}
+	return fmt.Sprintf("%s-%s-%d-%d", req.TrackName, req.ArtistName, batchTime, index)
+}
+
+// canReuseItemIDLocked reports whether a new deterministic submission may take
+// over the ID of the item at index, which is only allowed once that item has
+// finished.
+func canReuseItemIDLocked(index int, policy DuplicatePolicy) bool {
+	return deterministicIDs.Load() && policy != DuplicateSkipAny && isTerminalStatus(downloadQueue[index].Status)
+}
+
+func removeReusedItemLocked(index int) {
+	if index < 0 {
+		return
+	}
+	existing := downloadQueue[index]
+	downloadQueue = append(downloadQueue[:index], downloadQueue[index+1:]...)
+	publishQueueEvent(EventItemRemoved, existing)
+}
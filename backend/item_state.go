@@ -0,0 +1,75 @@
+package backend
+
+// releaseItemStateLocked drops per-item state that would otherwise outlive
+// the queue entry: the progress slot, attempt context, deadline and unused
+// pre-resolved source once the item has finished, its bandwidth limit once it has
+// completed, and its request headers once it is removed, since a failed item
+// can still be retried. A requeued item loses its progress slot so a late
+// update from the previous attempt is not flushed onto the next one.
+// Queue-wide events prune the state of every item that is no longer queued.
+func releaseItemStateLocked(eventType QueueEventType, item DownloadItem) {
+	switch {
+	case item.ID == "":
+		present := make(map[string]bool, len(downloadQueue))
+		for _, queued := range downloadQueue {
+			present[queued.ID] = true
+		}
+
+		itemHeadersLock.Lock()
+		for id := range itemHeaders {
+			if !present[id] {
+				delete(itemHeaders, id)
+			}
+		}
+		itemHeadersLock.Unlock()
+
+		itemLimitersLock.Lock()
+		for id := range itemLimiters {
+			if !present[id] {
+				delete(itemLimiters, id)
+			}
+		}
+		itemLimitersLock.Unlock()
+
+		itemContextsLock.Lock()
+		for id := range itemAttempts {
+			if !present[id] {
+				releaseItemContextLocked(id)
+			}
+		}
+		for id := range itemDeadlines {
+			if !present[id] {
+				releaseItemContextLocked(id)
+			}
+		}
+		itemContextsLock.Unlock()
+
+		for id := range preResolvedItems {
+			if !present[id] {
+				delete(preResolvedItems, id)
+			}
+		}
+		pendingProgress.Range(func(key, _ interface{}) bool {
+			if !present[key.(string)] {
+				pendingProgress.Delete(key)
+			}
+			return true
+		})
+	case eventType == EventItemRemoved || item.Status == StatusCompleted:
+		if eventType == EventItemRemoved {
+			itemHeadersLock.Lock()
+			delete(itemHeaders, item.ID)
+			itemHeadersLock.Unlock()
+		}
+		clearItemBandwidthLimit(item.ID)
+		fallthrough
+	case isTerminalStatus(item.Status):
+		delete(preResolvedItems, item.ID)
+		pendingProgress.Delete(item.ID)
+		itemContextsLock.Lock()
+		releaseItemContextLocked(item.ID)
+		itemContextsLock.Unlock()
+	case eventType == EventItemRequeued:
+		pendingProgress.Delete(item.ID)
+	}
+}
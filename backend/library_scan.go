@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const libraryScanWorkers = 8
+
+// libraryNameFormats are the built-in filename formats tried for queued items
+// that have no planned path yet.
+var libraryNameFormats = []string{"title-artist", "artist-title", "title"}
+
+type LibraryScanSummary struct {
+	Matched   []DownloadItem `json:"matched"`
+	Unmatched []string       `json:"unmatched"`
+	Scanned   int            `json:"scanned"`
+}
+
+func RescanLibrary(dir string) ([]DownloadItem, error) {
+	summary, err := RescanLibraryContext(context.Background(), dir)
+	return summary.Matched, err
+}
+
+// RescanLibraryContext marks queued items whose file already exists under dir
+// as skipped. A file matches an item at its planned path or, for items without
+// one, when it is named by one of the built-in filename formats in any folder
+// of dir. The extension is ignored in both cases.
+func RescanLibraryContext(ctx context.Context, dir string) (LibraryScanSummary, error) {
+	downloadQueueLock.RLock()
+	planned := make(map[string]string)
+	named := make(map[string]string)
+	for _, item := range downloadQueue {
+		if item.Status != StatusQueued {
+			continue
+		}
+		if item.PlannedPath != "" {
+			planned[libraryMatchKey(item.PlannedPath)] = item.ID
+			continue
+		}
+		if item.TrackName == "" || item.ArtistName == "" {
+			continue
+		}
+		for _, format := range libraryNameFormats {
+			name := libraryMatchKey(BuildExpectedFilename(item.TrackName, item.ArtistName, item.AlbumName, "", "", format, "", "", false, 0, 0, false))
+			if _, taken := named[name]; !taken {
+				named[name] = item.ID
+			}
+		}
+	}
+	downloadQueueLock.RUnlock()
+
+	paths := make(chan string)
+	var mu sync.Mutex
+	var summary LibraryScanSummary
+	matchedIDs := make(map[string]string)
+
+	var wg sync.WaitGroup
+	for i := 0; i < libraryScanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				key := libraryMatchKey(path)
+				id, ok := planned[key]
+				if !ok {
+					id, ok = named[filepath.Base(key)]
+				}
+
+				mu.Lock()
+				summary.Scanned++
+				if ok {
+					matchedIDs[id] = path
+				} else {
+					summary.Unmatched = append(summary.Unmatched, path)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() == 0 {
+			return nil
+		}
+
+		select {
+		case paths <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(paths)
+	wg.Wait()
+
+	if len(matchedIDs) > 0 {
+		downloadQueueLock.Lock()
+		for i := range downloadQueue {
+			item := downloadQueue[i]
+			path, ok := matchedIDs[item.ID]
+			if !ok || item.Status != StatusQueued {
+				continue
+			}
+			skipDownloadItemLocked(item.ID, path, "Already present")
+			summary.Matched = append(summary.Matched, downloadQueue[i])
+		}
+		evictHistoryLocked()
+		downloadQueueLock.Unlock()
+	}
+
+	return summary, walkErr
+}
+
+// libraryMatchKey drops the extension from a normalized path, since the
+// downloaders write .flac, .m4a or .mp3 depending on the source while planned
+// paths are built with .flac.
+func libraryMatchKey(path string) string {
+	path = normalizePath(path)
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+func normalizePath(path string) string {
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// GetItemByFilePath returns the item whose FilePath refers to path once both
+// are normalized. When several items share the path, the most recently added
+// one wins.
+func GetItemByFilePath(path string) (DownloadItem, bool) {
+	if path == "" {
+		return DownloadItem{}, false
+	}
+	target := normalizePath(path)
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	for i := len(downloadQueue) - 1; i >= 0; i-- {
+		item := downloadQueue[i]
+		if item.FilePath != "" && normalizePath(item.FilePath) == target {
+			return item, true
+		}
+	}
+	return DownloadItem{}, false
+}
@@ -0,0 +1,33 @@
+package backend
+
+import "sync/atomic"
+
+var lifetimeDownloaded atomic.Int64
+
+// GetLifetimeTotal returns the bytes downloaded across all sessions. Unlike the
+// session total it survives ClearAllDownloads and ResetSessionIfComplete, and
+// is persisted with the queue file.
+func GetLifetimeTotal() int64 {
+	return lifetimeDownloaded.Load()
+}
+
+func ResetLifetimeTotal() {
+	lifetimeDownloaded.Store(0)
+}
+
+// raiseLifetimeTotal restores a persisted total without lowering the current
+// one, so loading an older queue file does not undo downloads since.
+func raiseLifetimeTotal(bytes int64) {
+	for {
+		current := lifetimeDownloaded.Load()
+		if bytes <= current || lifetimeDownloaded.CompareAndSwap(current, bytes) {
+			return
+		}
+	}
+}
+
+func addLifetimeTotal(mb float64) {
+	if mb > 0 {
+		lifetimeDownloaded.Add(int64(mb * bytesPerMiB))
+	}
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+var queueLogger atomic.Pointer[slog.Logger]
+
+func SetLogger(logger *slog.Logger) {
+	queueLogger.Store(logger)
+}
+
+var transitionMessages = map[QueueEventType]string{
+	EventItemAdded:     "download queued",
+	EventItemStarted:   "download started",
+	EventItemCompleted: "download completed",
+	EventItemFailed:    "download failed",
+	EventItemSkipped:   "download skipped",
+	EventItemRequeued:  "download retried",
+}
+
+func logTransition(eventType QueueEventType, item DownloadItem) {
+	logger := queueLogger.Load()
+	if logger == nil {
+		return
+	}
+
+	msg, ok := transitionMessages[eventType]
+	if !ok {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("item_id", item.ID),
+		slog.String("track", item.TrackName),
+		slog.String("artist", item.ArtistName),
+		slog.String("status", string(item.Status)),
+	}
+	if item.Source != "" {
+		attrs = append(attrs, slog.String("source", item.Source))
+	}
+	if item.ExpectedSize > 0 {
+		attrs = append(attrs, slog.Int64("expected_bytes", item.ExpectedSize))
+	}
+	if item.TotalSize > 0 {
+		attrs = append(attrs, slog.Float64("size_mb", item.TotalSize))
+	}
+	if item.QueueWaitSeconds > 0 {
+		attrs = append(attrs, slog.Float64("queue_wait_seconds", item.QueueWaitSeconds))
+	}
+	if item.StartTime > 0 && item.EndTime >= item.StartTime {
+		attrs = append(attrs, slog.Int64("duration_seconds", item.EndTime-item.StartTime))
+	}
+	if item.RetryCount > 0 {
+		attrs = append(attrs, slog.Int("retry_count", item.RetryCount))
+	}
+	if item.ErrorMessage != "" {
+		attrs = append(attrs, slog.String("error", item.ErrorMessage))
+	}
+	if item.FilePath != "" {
+		attrs = append(attrs, slog.String("file_path", item.FilePath))
+	}
+
+	level := slog.LevelInfo
+	if eventType == EventItemFailed {
+		level = slog.LevelWarn
+	}
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
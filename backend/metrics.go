@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+var metricStatuses = []DownloadStatus{
+	StatusQueued,
+	StatusHeld,
+	StatusDownloading,
+	StatusCompleted,
+	StatusFailed,
+	StatusSkipped,
+}
+
+// statusTransitions counts how many times an item has entered each status
+// since startup, so it keeps growing when the queue is cleared. It is guarded
+// by downloadQueueLock.
+var statusTransitions = make(map[DownloadStatus]int64)
+
+func countStatusTransitionLocked(eventType QueueEventType, item DownloadItem) {
+	if item.ID == "" || eventType == EventItemProgress || eventType == EventItemRemoved {
+		return
+	}
+	statusTransitions[item.Status]++
+}
+
+func WriteMetrics(w io.Writer) error {
+	downloadQueueLock.RLock()
+	counts := make(map[DownloadStatus]int, len(metricStatuses))
+	for _, item := range downloadQueue {
+		counts[item.Status]++
+	}
+	transitions := make(map[DownloadStatus]int64, len(metricStatuses))
+	for _, status := range metricStatuses {
+		transitions[status] = statusTransitions[status]
+	}
+	downloadQueueLock.RUnlock()
+
+	speedLock.RLock()
+	speedBytes := currentSpeed * 1024 * 1024
+	speedLock.RUnlock()
+
+	sessionStartLock.RLock()
+	_, wall, paused := sessionTimesLocked()
+	sessionStartLock.RUnlock()
+
+	uptime := int64((wall - paused).Seconds())
+
+	var b strings.Builder
+
+	writeMetricHeader(&b, "spotiflac_downloaded_bytes_total", "counter", "Total bytes downloaded across all sessions.")
+	fmt.Fprintf(&b, "spotiflac_downloaded_bytes_total %d\n", GetLifetimeTotal())
+
+	writeMetricHeader(&b, "spotiflac_download_speed_bytes", "gauge", "Current aggregate download speed in bytes per second.")
+	fmt.Fprintf(&b, "spotiflac_download_speed_bytes %.0f\n", speedBytes)
+
+	writeMetricHeader(&b, "spotiflac_downloads_total", "counter", "Number of times an item has entered each status.")
+	for _, status := range metricStatuses {
+		fmt.Fprintf(&b, "spotiflac_downloads_total{status=%q} %d\n", string(status), transitions[status])
+	}
+
+	writeMetricHeader(&b, "spotiflac_queue_items", "gauge", "Number of queue items by status.")
+	for _, status := range metricStatuses {
+		fmt.Fprintf(&b, "spotiflac_queue_items{status=%q} %d\n", string(status), counts[status])
+	}
+
+	writeMetricHeader(&b, "spotiflac_active_downloads", "gauge", "Number of downloads currently in progress.")
+	fmt.Fprintf(&b, "spotiflac_active_downloads %d\n", atomic.LoadInt64(&activeDownloads))
+
+	writeMetricHeader(&b, "spotiflac_session_uptime_seconds", "gauge", "Seconds since the current download session started, excluding time spent paused.")
+	fmt.Fprintf(&b, "spotiflac_session_uptime_seconds %d\n", uptime)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WriteMetrics(w); err != nil {
+		fmt.Printf("Failed to write metrics: %v\n", err)
+	}
+}
+
+func writeMetricHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
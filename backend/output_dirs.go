@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+var dontCreateDirs atomic.Bool
+
+// SetCreateDirs controls whether downloaders create missing output
+// directories. It is on by default; when off, a missing directory fails the
+// item with a "disk" error instead.
+func SetCreateDirs(enabled bool) {
+	dontCreateDirs.Store(!enabled)
+}
+
+func ensureOutputDir(dir string) error {
+	if dir == "" || dir == "." {
+		return nil
+	}
+	if !dontCreateDirs.Load() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return newDownloadError("", ErrorCategoryDisk, fmt.Errorf("failed to create output directory: %w", err), 0)
+		}
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return newDownloadError("", ErrorCategoryDisk, fmt.Errorf("directory does not exist: %s", dir), 0)
+	}
+	if err != nil {
+		return newDownloadError("", ErrorCategoryDisk, err, 0)
+	}
+	return nil
+}
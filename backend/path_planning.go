@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type CollisionStrategy string
+
+const (
+	CollisionOverwrite CollisionStrategy = "overwrite"
+	CollisionRename    CollisionStrategy = "rename"
+	CollisionSkip      CollisionStrategy = "skip"
+)
+
+var ErrPathCollision = errors.New("planned file path already in use")
+
+var (
+	collisionStrategy     = CollisionRename
+	collisionStrategyLock sync.RWMutex
+)
+
+// SetCollisionStrategy controls how PlanItemPath resolves paths that are already
+// taken on disk or by another queued item. The default is CollisionRename.
+func SetCollisionStrategy(strategy CollisionStrategy) {
+	collisionStrategyLock.Lock()
+	collisionStrategy = strategy
+	collisionStrategyLock.Unlock()
+}
+
+// PlanItemPath stores path as the item's planned path, resolving a collision
+// with the current strategy. Under CollisionRename the returned path is the
+// uniquified one; under CollisionSkip the item is skipped and
+// ErrPathCollision is returned.
+func PlanItemPath(id, path string) (string, error) {
+	collisionStrategyLock.RLock()
+	strategy := collisionStrategy
+	collisionStrategyLock.RUnlock()
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	index := -1
+	taken := make(map[string]bool)
+	for i, item := range downloadQueue {
+		if item.ID == id {
+			index = i
+			continue
+		}
+		if item.PlannedPath != "" && !isTerminalStatus(item.Status) {
+			taken[normalizePath(item.PlannedPath)] = true
+		}
+	}
+	if index < 0 {
+		return "", fmt.Errorf("item %s not found", id)
+	}
+
+	inUse := func(candidate string) bool {
+		if taken[normalizePath(candidate)] {
+			return true
+		}
+		_, err := os.Stat(candidate)
+		return err == nil
+	}
+
+	planned := path
+	if inUse(path) {
+		switch strategy {
+		case CollisionSkip:
+			skipDownloadItemLocked(id, path, "File already exists")
+			evictHistoryLocked()
+			return path, ErrPathCollision
+		case CollisionRename:
+			planned = uniquePath(path, inUse)
+		}
+	}
+
+	downloadQueue[index].PlannedPath = planned
+	return planned, nil
+}
+
+// plannedOutputPath returns planned, the path PlanItemPath chose for an item,
+// with the extension of built, the path a downloader derived itself, so a
+// source that delivers another container keeps its extension. It returns
+// built when nothing was planned.
+func plannedOutputPath(planned, built string) string {
+	if planned == "" {
+		return built
+	}
+	return strings.TrimSuffix(planned, filepath.Ext(planned)) + filepath.Ext(built)
+}
+
+func uniquePath(path string, inUse func(string) bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if !inUse(candidate) {
+			return candidate
+		}
+	}
+}
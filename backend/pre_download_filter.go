@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrItemRejected = errors.New("item rejected by pre-download filter")
+
+const defaultRejectReason = "Rejected by pre-download filter"
+
+type PreDownloadFilter func(item DownloadItem) (allow bool, reason string)
+
+var (
+	preDownloadFilter     PreDownloadFilter
+	preDownloadFilterLock sync.RWMutex
+)
+
+// SetPreDownloadFilter installs a check that runs synchronously whenever an
+// item is about to start, before any network activity. Items it rejects are
+// skipped with the returned reason instead of downloading. The filter is
+// called without the queue lock held, so it may query the queue. Passing nil
+// removes it.
+func SetPreDownloadFilter(filter func(item DownloadItem) (allow bool, reason string)) {
+	preDownloadFilterLock.Lock()
+	preDownloadFilter = filter
+	preDownloadFilterLock.Unlock()
+}
+
+// admitItem runs the pre-download filter for item. When the item is rejected
+// it is skipped and the returned error wraps ErrItemRejected.
+func admitItem(item DownloadItem) error {
+	preDownloadFilterLock.RLock()
+	filter := preDownloadFilter
+	preDownloadFilterLock.RUnlock()
+
+	if filter == nil {
+		return nil
+	}
+	allow, reason := filter(item)
+	if allow {
+		return nil
+	}
+	if reason == "" {
+		reason = defaultRejectReason
+	}
+
+	downloadQueueLock.Lock()
+	if skipDownloadItemLocked(item.ID, "", reason) {
+		evictHistoryLocked()
+	}
+	downloadQueueLock.Unlock()
+
+	fmt.Printf("Skipping %s - %s: %s\n", item.TrackName, item.ArtistName, reason)
+	return fmt.Errorf("%w: %s", ErrItemRejected, reason)
+}
+
+func hasPreDownloadFilter() bool {
+	preDownloadFilterLock.RLock()
+	defer preDownloadFilterLock.RUnlock()
+	return preDownloadFilter != nil
+}
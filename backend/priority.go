@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var priorityAgingRate atomic.Int64
+
+// SetPriorityAging sets how many priority points a queued item gains for
+// every minute it waits, so low-priority items are eventually dispatched.
+// Priorities only affect dispatch under DispatchPriority.
+func SetPriorityAging(ratePerMinute int) {
+	if ratePerMinute < 0 {
+		ratePerMinute = 0
+	}
+	priorityAgingRate.Store(int64(ratePerMinute))
+}
+
+func SetItemPriority(id string, priority int) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		return fmt.Errorf("item %s not found", id)
+	}
+	downloadQueue[index].Priority = priority
+	return nil
+}
+
+func effectivePriority(item DownloadItem, now int64) int {
+	if item.Status != StatusQueued || item.QueuedAt == 0 {
+		return item.Priority
+	}
+
+	rate := priorityAgingRate.Load()
+	if rate == 0 || now <= item.QueuedAt {
+		return item.Priority
+	}
+
+	waitedMinutes := (now - item.QueuedAt) / 60000
+	return item.Priority + int(waitedMinutes*rate)
+}
+
+func highestPriorityLocked(candidates []int) []int {
+	if len(candidates) < 2 {
+		return candidates
+	}
+
+	now := getCurrentTimeMillis()
+	best := 0
+	var top []int
+	for _, index := range candidates {
+		priority := effectivePriority(downloadQueue[index], now)
+		switch {
+		case len(top) == 0 || priority > best:
+			best = priority
+			top = []int{index}
+		case priority == best:
+			top = append(top, index)
+		}
+	}
+	return top
+}
@@ -1,8 +1,13 @@
 package backend
 
 import (
+"context"
+"errors"
 "fmt"
 "io"
+"os"
+"strconv"
+"strings"
 "sync"
 "sync/atomic"
 "time"
@@ -16,22 +21,81 @@ StatusDownloading DownloadStatus = "downloading"
 StatusCompleted   DownloadStatus = "completed"
 StatusFailed      DownloadStatus = "failed"
 StatusSkipped     DownloadStatus = "skipped"
+StatusHeld        DownloadStatus = "held"
 )
 
+type DuplicatePolicy string
+
+const (
+DuplicateAllow      DuplicatePolicy = "allow"
+DuplicateSkipActive DuplicatePolicy = "skip_active"
+DuplicateSkipAny    DuplicatePolicy = "skip_any"
+)
+
+var (
+ErrDuplicateItem     = errors.New("item with the same Spotify ID is already in the queue")
+ErrQueueFull         = errors.New("download queue is full")
+ErrItemHeld          = errors.New("item is on hold")
+ErrDuplicateID       = errors.New("an item with this ID is already queued")
+ErrRecentlyCompleted = errors.New("item was completed recently and has been skipped")
+)
+
+type QueueRequest struct {
+ID           string `json:"id"`
+TrackName    string `json:"track_name"`
+ArtistName   string `json:"artist_name"`
+AlbumName    string `json:"album_name"`
+SpotifyID    string `json:"spotify_id"`
+Source       string `json:"source"`
+SourceURL    string `json:"source_url,omitempty"`
+ExpectedSize int64  `json:"expected_size,omitempty"`
+Format       string `json:"format,omitempty"`
+Bitrate      int    `json:"bitrate,omitempty"`
+}
+
 type DownloadItem struct {
-ID           string         `json:"id"`
-TrackName    string         `json:"track_name"`
-ArtistName   string         `json:"artist_name"`
-AlbumName    string         `json:"album_name"`
-SpotifyID    string         `json:"spotify_id"`
-Status       DownloadStatus `json:"status"`
-Progress     float64        `json:"progress"`
-TotalSize    float64        `json:"total_size"`
-Speed        float64        `json:"speed"`
-StartTime    int64          `json:"start_time"`
-EndTime      int64          `json:"end_time"`
-ErrorMessage string         `json:"error_message"`
-FilePath     string         `json:"file_path"`
+ID                string            `json:"id"`
+TrackName         string            `json:"track_name"`
+ArtistName        string            `json:"artist_name"`
+AlbumName         string            `json:"album_name"`
+SpotifyID         string            `json:"spotify_id"`
+Status            DownloadStatus    `json:"status"`
+Progress          float64           `json:"progress"`
+TotalSize         float64           `json:"total_size"`
+Speed             float64           `json:"speed"`
+StartTime         int64             `json:"start_time"`
+EndTime           int64             `json:"end_time"`
+ErrorMessage      string            `json:"error_message"`
+FilePath          string            `json:"file_path"`
+Pinned            bool              `json:"pinned"`
+Source            string            `json:"source"`
+QueuedAt          int64             `json:"queued_at"`
+QueueWaitSeconds  float64           `json:"queue_wait_seconds"`
+SourceURL         string            `json:"source_url"`
+ExpectedSize      int64             `json:"expected_size"`
+RetryCount        int               `json:"retry_count"`
+PlannedPath       string            `json:"planned_path"`
+ResolveMillis     int64             `json:"resolve_millis"`
+TTFBMillis        int64             `json:"ttfb_millis"`
+TransferMillis    int64             `json:"transfer_millis"`
+WireBytes         int64             `json:"wire_bytes"`
+DecodedBytes      int64             `json:"decoded_bytes"`
+Priority          int               `json:"priority"`
+ErrorCode         string            `json:"error_code"`
+StartedAtMillis   int64             `json:"started_at_millis"`
+StateHistory      []StateTransition `json:"state_history,omitempty"`
+Deadline          int64             `json:"deadline"`
+AttemptCount      int               `json:"attempt_count"`
+MaxAttempts       int               `json:"max_attempts"`
+EffectivePriority int               `json:"effective_priority"`
+Format            string            `json:"format"`
+Bitrate           int               `json:"bitrate"`
+HTTPStatus        int               `json:"http_status"`
+Percent           float64           `json:"percent"`
+Indeterminate     bool              `json:"indeterminate"`
+Fingerprint       string            `json:"fingerprint,omitempty"`
+Imported          bool              `json:"imported"`
+ContentLength     int64             `json:"content_length"`
 }
 
 var (
@@ -39,7 +103,10 @@ currentProgress     float64
 currentProgressLock sync.RWMutex
 activeDownloads     int64
 currentSpeed        float64
+writerSpeeds        = make(map[uint64]float64)
+averageSpeed        float64
 speedLock           sync.RWMutex
+nextWriterID        atomic.Uint64
 
 downloadQueue       []DownloadItem
 downloadQueueLock   sync.RWMutex
@@ -49,24 +116,53 @@ totalDownloaded     float64
 totalDownloadedLock sync.RWMutex
 sessionStartTime    int64
 sessionStartLock    sync.RWMutex
+
+duplicatePolicy = DuplicateAllow
+maxQueueSize    int
+queuePolicyLock sync.RWMutex
+
+redownloadDeletesFile atomic.Bool
+adaptiveReporting     atomic.Bool
+progressSteps         atomic.Int64
+maxRetries            atomic.Int64
+suppressInlineOutput  atomic.Bool
+acceptEmptyDownloads  atomic.Bool
+minValidFileSize      atomic.Int64
+)
+
+const (
+defaultReportThreshold  = 256 * 1024
+minReportThreshold      = 32 * 1024
+maxReportThreshold      = 8 * 1024 * 1024
+reportIntervalMillis    = 500
+maxReportIntervalMillis = 2000
+minSpeedSampleMillis    = 10
 )
 
 type ProgressInfo struct {
-IsDownloading bool    `json:"is_downloading"`
-MBDownloaded  float64 `json:"mb_downloaded"`
-SpeedMBps     float64 `json:"speed_mbps"`
+IsDownloading   bool    `json:"is_downloading"`
+MBDownloaded    float64 `json:"mb_downloaded"`
+SpeedMBps       float64 `json:"speed_mbps"`
+BytesRemaining  int64   `json:"bytes_remaining"`
+HasUnknownSizes bool    `json:"has_unknown_sizes"`
 }
 
 type DownloadQueueInfo struct {
-IsDownloading    bool           `json:"is_downloading"`
-Queue            []DownloadItem `json:"queue"`
-CurrentSpeed     float64        `json:"current_speed"`
-TotalDownloaded  float64        `json:"total_downloaded"`
-SessionStartTime int64          `json:"session_start_time"`
-QueuedCount      int            `json:"queued_count"`
-CompletedCount   int            `json:"completed_count"`
-FailedCount      int            `json:"failed_count"`
-SkippedCount     int            `json:"skipped_count"`
+IsDownloading       bool           `json:"is_downloading"`
+Queue               []DownloadItem `json:"queue"`
+CurrentSpeed        float64        `json:"current_speed"`
+TotalDownloaded     float64        `json:"total_downloaded"`
+SessionStartTime    int64          `json:"session_start_time"`
+QueuedCount         int            `json:"queued_count"`
+CompletedCount      int            `json:"completed_count"`
+FailedCount         int            `json:"failed_count"`
+SkippedCount        int            `json:"skipped_count"`
+HeldCount           int            `json:"held_count"`
+OverallProgress     float64        `json:"overall_progress"`
+ProgressByCount     float64        `json:"progress_by_count"`
+ProgressByBytes     float64        `json:"progress_by_bytes"`
+RemainingUntilPause int            `json:"remaining_until_pause"`
+SchedulePaused      bool           `json:"schedule_paused"`
 }
 
 func GetDownloadProgress() ProgressInfo {
@@ -80,19 +176,98 @@ speedLock.RLock()
 speed := currentSpeed
 speedLock.RUnlock()
 
+remaining, unknown := bytesRemaining()
+
 return ProgressInfo{
-IsDownloading: downloading,
-MBDownloaded:  progress,
-SpeedMBps:     speed,
+IsDownloading:   downloading,
+MBDownloaded:    quantizeProgress(progress),
+SpeedMBps:       speed,
+BytesRemaining:  remaining,
+HasUnknownSizes: unknown,
+}
+}
+
+// bytesRemaining sums what is left of the expected sizes of pending items.
+// Items without a known size are left out and reported through unknown, so
+// the total is then a lower bound.
+func bytesRemaining() (remaining int64, unknown bool) {
+downloadQueueLock.RLock()
+defer downloadQueueLock.RUnlock()
+
+for _, item := range downloadQueue {
+switch item.Status {
+case StatusQueued, StatusHeld, StatusDownloading:
+default:
+continue
 }
+size := knownItemSize(item)
+if size <= 0 {
+unknown = true
+continue
+}
+if left := size - int64(item.Progress*bytesPerMiB); left > 0 {
+remaining += left
+}
+}
+return remaining, unknown
 }
 
 func SetDownloadSpeed(mbps float64) {
+setWriterSpeed(0, mbps)
+}
+
+func setWriterSpeed(writerID uint64, mbps float64) {
+speedLock.Lock()
+writerSpeeds[writerID] = mbps
+recomputeSpeedLocked()
+speedLock.Unlock()
+}
+
+func clearWriterSpeed(writerID uint64) {
 speedLock.Lock()
-currentSpeed = mbps
+delete(writerSpeeds, writerID)
+delete(writerItems, writerID)
+recomputeSpeedLocked()
 speedLock.Unlock()
 }
 
+func resetDownloadSpeed() {
+speedLock.Lock()
+writerSpeeds = make(map[uint64]float64)
+writerItems = make(map[uint64]string)
+currentSpeed = 0
+speedLock.Unlock()
+}
+
+// ResetTransientMetrics clears the progress and speed readouts without touching
+// the queue, totals or session timer. Active writers repopulate them on their
+// next report.
+func ResetTransientMetrics() {
+SetDownloadProgress(0)
+resetDownloadSpeed()
+resetAverageSpeed()
+resetThroughputSample()
+}
+
+func recomputeSpeedLocked() {
+if queuePaused.Load() {
+currentSpeed = 0
+return
+}
+var total float64
+for _, speed := range writerSpeeds {
+total += speed
+}
+currentSpeed = total
+if total > 0 {
+if averageSpeed == 0 {
+averageSpeed = total
+} else {
+averageSpeed += speedSmoothing * (total - averageSpeed)
+}
+}
+}
+
 func SetDownloadProgress(mbDownloaded float64) {
 currentProgressLock.Lock()
 currentProgress = mbDownloaded
@@ -102,23 +277,32 @@ currentProgressLock.Unlock()
 func SetDownloading(downloading bool) {
 if downloading {
 atomic.AddInt64(&activeDownloads, 1)
+startSpeedSampler()
 } else {
 if atomic.AddInt64(&activeDownloads, -1) <= 0 {
 atomic.StoreInt64(&activeDownloads, 0)
 SetDownloadProgress(0)
-SetDownloadSpeed(0)
+resetDownloadSpeed()
 }
 }
 }
 
 type ProgressWriter struct {
-writer      io.Writer
-total       int64
-lastPrinted int64
-startTime   int64
-lastTime    int64
-lastBytes   int64
-itemID      string
+writer        io.Writer
+total         int64
+lastPrinted   int64
+startTime     int64
+lastTime      int64
+lastBytes     int64
+itemID        string
+threshold     int64
+id            uint64
+expected      int64
+firstByteTime int64
+buf           []byte
+wire          int64
+lastWire      int64
+ctx           context.Context
 }
 
 func NewProgressWriter(writer io.Writer) *ProgressWriter {
@@ -128,39 +312,108 @@ writer:      writer,
 total:       0,
 lastPrinted: 0,
 startTime:   now,
-lastTime:    now,
+lastTime:    speedClock(),
 lastBytes:   0,
 itemID:      "",
+threshold:   defaultReportThreshold,
+id:          nextWriterID.Add(1),
 }
 }
 
 func NewProgressWriterWithID(writer io.Writer, itemID string) *ProgressWriter {
 pw := NewProgressWriter(writer)
 pw.itemID = itemID
+pw.expected = getItemExpectedSize(itemID)
+if itemID != "" {
+pw.ctx = ItemContext(itemID)
+}
 return pw
 }
 
+func (pw *ProgressWriter) SetExpectedSize(bytes int64) {
+if bytes <= 0 {
+return
+}
+pw.expected = bytes
+if pw.itemID != "" {
+setItemContentLength(pw.itemID, bytes)
+}
+}
+
 func getCurrentTimeMillis() int64 {
 return time.Now().UnixMilli()
 }
 
+var monotonicEpoch = time.Now()
+
+// speedClock returns milliseconds from the monotonic clock, which keeps
+// moving forward when the wall clock is adjusted. Speed sampling uses it
+// instead of getCurrentTimeMillis.
+var speedClock = func() int64 {
+return time.Since(monotonicEpoch).Milliseconds()
+}
+
 func (pw *ProgressWriter) Write(p []byte) (int, error) {
-n, err := pw.writer.Write(p)
+if pw.ctx != nil {
+if cause := context.Cause(pw.ctx); cause != nil {
+return 0, cause
+}
+}
+throttleWrite(pw.itemID, len(p))
+n, err := pw.writeToDisk(p)
+if pw.firstByteTime == 0 && n > 0 {
+pw.firstByteTime = getCurrentTimeMillis()
+}
 pw.total += int64(n)
+aggregateBytes.Add(int64(n))
+
+if pw.shouldReport() {
+pw.report()
+}
+
+return n, err
+}
+
+func (pw *ProgressWriter) shouldReport() bool {
+pending := pw.total - pw.lastPrinted
+if pending <= 0 {
+return false
+}
+if pending >= pw.reportThreshold() {
+return true
+}
+if pw.expected > 0 && pw.total >= pw.expected {
+return true
+}
+return progressSteps.Load() > 0 && speedClock()-pw.lastTime >= maxReportIntervalMillis
+}
 
-if pw.total-pw.lastPrinted >= 256*1024 {
+func (pw *ProgressWriter) report() {
 mbDownloaded := float64(pw.total) / (1024 * 1024)
 
-now := getCurrentTimeMillis()
-timeDiff := float64(now-pw.lastTime) / 1000.0
+now := speedClock()
+elapsed := now - pw.lastTime
 bytesDiff := float64(pw.total - pw.lastBytes)
+if pw.wire > 0 {
+bytesDiff = float64(pw.wire - pw.lastWire)
+}
+
+// A non-positive delta means the clock did not advance, so the sample is
+// dropped and its bytes are carried into the next one.
+sampled := elapsed > 0
+if sampled && elapsed < minSpeedSampleMillis {
+elapsed = minSpeedSampleMillis
+}
+timeDiff := float64(elapsed) / 1000.0
 
 var speedMBps float64
-if timeDiff > 0 {
+if sampled {
 speedMBps = (bytesDiff / (1024 * 1024)) / timeDiff
-SetDownloadSpeed(speedMBps)
+setItemWriterSpeed(pw.id, pw.itemID, speedMBps)
+if !suppressInlineOutput.Load() {
 fmt.Printf("\rDownloaded: %.2f MB (%.2f MB/s)", mbDownloaded, speedMBps)
-} else {
+}
+} else if !suppressInlineOutput.Load() {
 fmt.Printf("\rDownloaded: %.2f MB", mbDownloaded)
 }
 
@@ -168,76 +421,340 @@ SetDownloadProgress(mbDownloaded)
 
 if pw.itemID != "" {
 UpdateItemProgress(pw.itemID, mbDownloaded, speedMBps)
+updateItemBytes(pw.itemID, pw.GetWireBytes(), pw.total)
 }
 
 pw.lastPrinted = pw.total
+if sampled {
 pw.lastTime = now
 pw.lastBytes = pw.total
+pw.lastWire = pw.wire
 }
 
-return n, err
+if speedMBps > 0 {
+pw.tuneThreshold(speedMBps)
+}
+}
+
+func SetAdaptiveReporting(enabled bool) {
+adaptiveReporting.Store(enabled)
+}
+
+func SetProgressSteps(steps int) {
+if steps < 0 {
+steps = 0
+}
+progressSteps.Store(int64(steps))
+}
+
+func (pw *ProgressWriter) reportThreshold() int64 {
+threshold := int64(defaultReportThreshold)
+if adaptiveReporting.Load() {
+threshold = pw.threshold
+}
+if steps := progressSteps.Load(); steps > 0 && pw.expected > 0 {
+if stepBytes := pw.expected / steps; stepBytes > threshold {
+threshold = stepBytes
+}
+}
+return threshold
+}
+
+func (pw *ProgressWriter) tuneThreshold(speedMBps float64) {
+bytesPerInterval := int64(speedMBps * 1024 * 1024 * reportIntervalMillis / 1000)
+if bytesPerInterval < minReportThreshold {
+bytesPerInterval = minReportThreshold
+}
+if bytesPerInterval > maxReportThreshold {
+bytesPerInterval = maxReportThreshold
+}
+pw.threshold = bytesPerInterval
 }
 
 func (pw *ProgressWriter) GetTotal() int64 {
 return pw.total
 }
 
-func AddToQueue(id, trackName, artistName, albumName, spotifyID string) {
+func (pw *ProgressWriter) Finish() error {
+err := pw.flush()
+pw.releaseBuffer()
+if pw.total > pw.lastPrinted {
+pw.report()
+}
+clearWriterSpeed(pw.id)
+if pw.itemID != "" && pw.firstByteTime > 0 {
+SetItemTransferMillis(pw.itemID, getCurrentTimeMillis()-pw.firstByteTime)
+}
+return err
+}
+
+func SetDuplicatePolicy(policy DuplicatePolicy) {
+queuePolicyLock.Lock()
+duplicatePolicy = policy
+queuePolicyLock.Unlock()
+}
+
+func SetMaxQueueSize(size int) {
+if size < 0 {
+size = 0
+}
+queuePolicyLock.Lock()
+maxQueueSize = size
+queuePolicyLock.Unlock()
+}
+
+func AddToQueue(id, trackName, artistName, albumName, spotifyID string) error {
+return AddToQueueFull(QueueRequest{
+ID:         id,
+TrackName:  trackName,
+ArtistName: artistName,
+AlbumName:  albumName,
+SpotifyID:  spotifyID,
+})
+}
+
+// AddToQueueFull queues an item whose source metadata is already known.
+// A non-empty SourceURL makes the item skip the source resolver on its first
+// attempt; retries resolve it again, since the URL may have expired.
+// ExpectedSize is used for progress, ETA and existing-file checks straight
+// away.
+func AddToQueueFull(req QueueRequest) error {
+if req.ID == "" {
+req.ID = generateItemID(req, 0, 0)
+}
+
 downloadQueueLock.Lock()
 defer downloadQueueLock.Unlock()
 
-item := DownloadItem{
-ID:         id,
+err := addToQueueLocked(req)
+if err == nil {
+startSessionIfNeeded()
+triggerAutoStart()
+}
+return err
+}
+
+func AddToQueueAutoID(trackName, artistName, albumName, spotifyID string) (string, error) {
+id := generateItemID(QueueRequest{
 TrackName:  trackName,
 ArtistName: artistName,
 AlbumName:  albumName,
 SpotifyID:  spotifyID,
-Status:     StatusQueued,
-Progress:   0,
-TotalSize:  0,
-Speed:      0,
-StartTime:  0,
-EndTime:    0,
+}, 0, 0)
+return id, AddToQueue(id, trackName, artistName, albumName, spotifyID)
+}
+
+// BatchSkip describes a request AddBatch did not queue. Index points into the
+// requests passed to AddBatch.
+type BatchSkip struct {
+Index  int    `json:"index"`
+ID     string `json:"id"`
+Reason string `json:"reason"`
+}
+
+// BatchResult holds the ID of each queued request, in request order, with an
+// empty ID for the ones that were skipped, and why each of those was skipped.
+type BatchResult struct {
+IDs     []string    `json:"ids"`
+Skipped []BatchSkip `json:"skipped"`
+}
+
+func AddBatch(items []QueueRequest) BatchResult {
+downloadQueueLock.Lock()
+defer downloadQueueLock.Unlock()
+
+result := BatchResult{IDs: make([]string, len(items)), Skipped: []BatchSkip{}}
+now := time.Now().UnixNano()
+added := false
+
+for i, req := range items {
+if req.ID == "" {
+req.ID = generateItemID(req, now, i)
+}
+
+if err := addToQueueLocked(req); err != nil {
+if errors.Is(err, ErrRecentlyCompleted) {
+added = true
+}
+result.Skipped = append(result.Skipped, BatchSkip{Index: i, ID: req.ID, Reason: err.Error()})
+continue
+}
+
+result.IDs[i] = req.ID
+added = true
+}
+
+if added {
+startSessionIfNeeded()
+triggerAutoStart()
+}
+return result
+}
+
+func addToQueueLocked(req QueueRequest) error {
+queuePolicyLock.RLock()
+policy := duplicatePolicy
+limit := maxQueueSize
+queuePolicyLock.RUnlock()
+
+reused := indexOfItemLocked(req.ID)
+if reused >= 0 && !canReuseItemIDLocked(reused, policy) {
+return ErrDuplicateID
+}
+
+if isDuplicateLocked(req.SpotifyID, policy) {
+return ErrDuplicateItem
 }
 
+if path, ok := recentCompletionPath(req.SpotifyID); ok {
+removeReusedItemLocked(reused)
+skipped := newQueueItem(req)
+recordQueueWait(&skipped)
+skipped.Status = StatusSkipped
+skipped.EndTime = time.Now().Unix()
+skipped.FilePath = path
+skipped.ErrorMessage = "Completed recently"
+downloadQueue = append(downloadQueue, skipped)
+publishQueueEvent(EventItemSkipped, skipped)
+return ErrRecentlyCompleted
+}
+
+if limit > 0 && pendingCountLocked() >= limit {
+return ErrQueueFull
+}
+
+removeReusedItemLocked(reused)
+item := newQueueItem(req)
+if req.SourceURL != "" {
+preResolvedItems[req.ID] = true
+}
 downloadQueue = append(downloadQueue, item)
+publishQueueEvent(EventItemAdded, item)
+return nil
+}
+
+func newQueueItem(req QueueRequest) DownloadItem {
+return DownloadItem{
+ID:           req.ID,
+TrackName:    req.TrackName,
+ArtistName:   req.ArtistName,
+AlbumName:    req.AlbumName,
+SpotifyID:    req.SpotifyID,
+Source:       req.Source,
+SourceURL:    req.SourceURL,
+ExpectedSize: req.ExpectedSize,
+Format:       req.Format,
+Bitrate:      req.Bitrate,
+Status:       StatusQueued,
+QueuedAt:     getCurrentTimeMillis(),
+Progress:     0,
+TotalSize:    0,
+Speed:        0,
+StartTime:    0,
+EndTime:      0,
+}
+}
+
+func isDuplicateLocked(spotifyID string, policy DuplicatePolicy) bool {
+if spotifyID == "" || policy == DuplicateAllow {
+return false
+}
+for _, existing := range downloadQueue {
+if existing.SpotifyID != spotifyID {
+continue
+}
+if policy == DuplicateSkipAny || !isTerminalStatus(existing.Status) {
+return true
+}
+}
+return false
+}
+
+func pendingCountLocked() int {
+pending := 0
+for _, existing := range downloadQueue {
+if existing.Status == StatusQueued || existing.Status == StatusDownloading || existing.Status == StatusHeld {
+pending++
+}
+}
+return pending
+}
 
+func startSessionIfNeeded() {
 sessionStartLock.Lock()
 if sessionStartTime == 0 {
 sessionStartTime = time.Now().Unix()
+resetSessionPauseLocked()
 }
 sessionStartLock.Unlock()
 }
 
-func StartDownloadItem(id string) {
+func StartDownloadItem(id string) error {
 downloadQueueLock.Lock()
-defer downloadQueueLock.Unlock()
+index := indexOfItemLocked(id)
+if index >= 0 && downloadQueue[index].Status == StatusHeld {
+downloadQueueLock.Unlock()
+return ErrItemHeld
+}
+if index >= 0 && hasPreDownloadFilter() {
+candidate := downloadQueue[index]
+downloadQueueLock.Unlock()
 
-for i := range downloadQueue {
-if downloadQueue[i].ID == id {
-downloadQueue[i].Status = StatusDownloading
-downloadQueue[i].StartTime = time.Now().Unix()
-downloadQueue[i].Progress = 0
-break
+if err := admitItem(candidate); err != nil {
+return err
 }
+
+downloadQueueLock.Lock()
+index = indexOfItemLocked(id)
+if index >= 0 && downloadQueue[index].Status == StatusHeld {
+downloadQueueLock.Unlock()
+return ErrItemHeld
+}
+}
+var started DownloadItem
+if index >= 0 {
+started = markStartedLocked(index)
+}
+downloadQueueLock.Unlock()
+
+return afterStart(id, started, index >= 0)
 }
 
+func markStartedLocked(index int) DownloadItem {
+item := &downloadQueue[index]
+recordQueueWait(item)
+item.Status = StatusDownloading
+item.AttemptCount++
+item.MaxAttempts = int(maxRetries.Load()) + 1
+item.StartTime = time.Now().Unix()
+item.StartedAtMillis = getCurrentTimeMillis()
+item.Progress = 0
+item.HTTPStatus = 0
+item.ContentLength = 0
+item.TTFBMillis = 0
+resetItemAttempt(item.ID)
+forgetScheduleInterruption(item.ID)
+claimDownload(item.ID)
+publishQueueEvent(EventItemStarted, *item)
+return *item
+}
+
+func afterStart(id string, started DownloadItem, found bool) error {
 currentItemLock.Lock()
 currentItemID = id
 currentItemLock.Unlock()
-}
 
-func UpdateItemProgress(id string, progress, speed float64) {
-downloadQueueLock.Lock()
-defer downloadQueueLock.Unlock()
-
-for i := range downloadQueue {
-if downloadQueue[i].ID == id {
-downloadQueue[i].Progress = progress
-downloadQueue[i].Speed = speed
-break
+if !found {
+return nil
 }
+return resolveItemSource(started)
 }
+
+func recordQueueWait(item *DownloadItem) {
+if item.QueuedAt == 0 {
+return
+}
+item.QueueWaitSeconds = float64(getCurrentTimeMillis()-item.QueuedAt) / 1000.0
 }
 
 func GetCurrentItemID() string {
@@ -246,12 +763,42 @@ defer currentItemLock.RUnlock()
 return currentItemID
 }
 
+func SetTreatEmptyAsFailure(enabled bool) {
+acceptEmptyDownloads.Store(!enabled)
+}
+
+// SetMinValidFileSize fails completed downloads smaller than bytes, unless
+// the item's expected size is known and no larger than the file. This catches
+// sources that answer with a small error page. 0 disables the check.
+func SetMinValidFileSize(bytes int64) {
+if bytes < 0 {
+bytes = 0
+}
+minValidFileSize.Store(bytes)
+}
+
 func CompleteDownloadItem(id, filePath string, finalSize float64) {
+if finalSize <= 0 && !acceptEmptyDownloads.Load() {
+failInvalidDownload(id, filePath, "Empty response")
+return
+}
+if minSize := minValidFileSize.Load(); minSize > 0 && finalSize > 0 {
+size := int64(finalSize * bytesPerMiB)
+expected := getItemExpectedSize(id)
+if size < minSize && (expected <= 0 || size < expected) {
+failInvalidDownload(id, filePath, "Response too small, likely an error page")
+return
+}
+}
+
 downloadQueueLock.Lock()
 defer downloadQueueLock.Unlock()
 
 for i := range downloadQueue {
 if downloadQueue[i].ID == id {
+if downloadQueue[i].Status == StatusCompleted {
+return
+}
 downloadQueue[i].Status = StatusCompleted
 downloadQueue[i].EndTime = time.Now().Unix()
 downloadQueue[i].FilePath = filePath
@@ -261,38 +808,243 @@ downloadQueue[i].TotalSize = finalSize
 totalDownloadedLock.Lock()
 totalDownloaded += finalSize
 totalDownloadedLock.Unlock()
+addLifetimeTotal(finalSize)
+addSourceBandwidth(downloadQueue[i].Source, finalSize)
+recordCompletion(downloadQueue[i].SpotifyID, filePath)
+countAutoPauseCompletion()
+ReleaseDownloadItem(id)
+publishQueueEvent(EventItemCompleted, downloadQueue[i])
 break
 }
 }
+evictHistoryLocked()
+}
+
+func failInvalidDownload(id, filePath, reason string) {
+downloadQueueLock.Lock()
+index := indexOfItemLocked(id)
+if index < 0 || downloadQueue[index].Status == StatusCompleted {
+downloadQueueLock.Unlock()
+return
+}
+if filePath != "" {
+downloadQueue[index].FilePath = filePath
+}
+failed, ok := failDownloadItemLocked(id, errors.New(reason))
+evictHistoryLocked()
+downloadQueueLock.Unlock()
+
+if ok && failed.Status == StatusFailed {
+handleFailedFile(failed)
+}
+}
+
+func SetMaxRetries(retries int) {
+if retries < 0 {
+retries = 0
+}
+maxRetries.Store(int64(retries))
 }
 
 func FailDownloadItem(id, errorMsg string) {
+FailDownloadItemErr(id, errors.New(errorMsg))
+}
+
+func FailDownloadItemErr(id string, err error) {
+if err == nil {
+return
+}
+
 downloadQueueLock.Lock()
-defer downloadQueueLock.Unlock()
+failed, ok := failDownloadItemLocked(id, err)
+evictHistoryLocked()
+downloadQueueLock.Unlock()
+
+if ok && failed.Status == StatusFailed {
+handleFailedFile(failed)
+}
+}
 
+func failDownloadItemLocked(id string, err error) (DownloadItem, bool) {
 for i := range downloadQueue {
-if downloadQueue[i].ID == id {
-downloadQueue[i].Status = StatusFailed
-downloadQueue[i].EndTime = time.Now().Unix()
-downloadQueue[i].ErrorMessage = errorMsg
-break
+if downloadQueue[i].ID != id {
+continue
+}
+
+item := &downloadQueue[i]
+if item.Status == StatusFailed {
+return *item, false
+}
+ReleaseDownloadItem(id)
+if item.Status == StatusSkipped {
+return *item, false
+}
+err = withStopCause(id, err)
+if requeueIfInterruptedLocked(item, err) {
+return *item, false
+}
+
+if status := HTTPStatusOf(err); status > 0 {
+item.HTTPStatus = status
+} else if item.HTTPStatus > 0 {
+err = statusError(id, item.HTTPStatus, err)
+}
+errorMsg := err.Error()
+if item.HTTPStatus > 0 && !strings.Contains(errorMsg, strconv.Itoa(item.HTTPStatus)) {
+errorMsg = fmt.Sprintf("%s (HTTP %d)", errorMsg, item.HTTPStatus)
+}
+errorCode := ""
+var downloadErr *DownloadError
+if errors.As(err, &downloadErr) {
+errorCode = string(downloadErr.Category)
 }
+item.ErrorCode = errorCode
+retriesLeft := item.RetryCount < int(maxRetries.Load())
+if retriesLeft && !shouldRetry(err, item.RetryCount+1) {
+retriesLeft = false
+fmt.Printf("Not retrying %s - %s (retry predicate declined): %s\n", item.TrackName, item.ArtistName, errorMsg)
 }
+if retriesLeft {
+item.RetryCount++
+item.Status = StatusQueued
+item.QueuedAt = getCurrentTimeMillis()
+item.StartTime = 0
+item.StartedAtMillis = 0
+item.Progress = 0
+item.Speed = 0
+item.ErrorMessage = errorMsg
+fmt.Printf("Retrying %s - %s (attempt %d of %d): %s\n", item.TrackName, item.ArtistName, item.RetryCount, maxRetries.Load(), errorMsg)
+publishQueueEvent(EventItemRequeued, *item)
+triggerAutoStart()
+return *item, true
+}
+
+item.Status = StatusFailed
+item.EndTime = time.Now().Unix()
+item.ErrorMessage = errorMsg
+publishQueueEvent(EventItemFailed, *item)
+return *item, true
+}
+return DownloadItem{}, false
 }
 
 func SkipDownloadItem(id, filePath string) {
 downloadQueueLock.Lock()
 defer downloadQueueLock.Unlock()
 
+skipDownloadItemLocked(id, filePath, "")
+evictHistoryLocked()
+}
+
+func skipDownloadItemLocked(id, filePath, reason string) bool {
 for i := range downloadQueue {
 if downloadQueue[i].ID == id {
+if downloadQueue[i].Status == StatusSkipped {
+return false
+}
+if downloadQueue[i].Status == StatusQueued {
+recordQueueWait(&downloadQueue[i])
+}
 downloadQueue[i].Status = StatusSkipped
 downloadQueue[i].EndTime = time.Now().Unix()
+if filePath != "" {
 downloadQueue[i].FilePath = filePath
-break
 }
+if reason != "" {
+downloadQueue[i].ErrorMessage = reason
+}
+ReleaseDownloadItem(id)
+publishQueueEvent(EventItemSkipped, downloadQueue[i])
+return true
 }
 }
+return false
+}
+
+func SetRedownloadDeletesFile(enabled bool) {
+redownloadDeletesFile.Store(enabled)
+}
+
+func RedownloadItem(id string) error {
+downloadQueueLock.Lock()
+defer downloadQueueLock.Unlock()
+
+for i := range downloadQueue {
+if downloadQueue[i].ID != id {
+continue
+}
+
+item := &downloadQueue[i]
+if item.Status != StatusCompleted {
+return fmt.Errorf("item %s is not completed (status: %s)", id, item.Status)
+}
+
+if redownloadDeletesFile.Load() && item.FilePath != "" {
+if err := os.Remove(item.FilePath); err != nil && !os.IsNotExist(err) {
+return fmt.Errorf("failed to delete existing file: %w", err)
+}
+}
+
+totalDownloadedLock.Lock()
+totalDownloaded -= item.TotalSize
+if totalDownloaded < 0 {
+totalDownloaded = 0
+}
+totalDownloadedLock.Unlock()
+
+item.Status = StatusQueued
+item.QueuedAt = getCurrentTimeMillis()
+item.QueueWaitSeconds = 0
+item.StartTime = 0
+item.StartedAtMillis = 0
+item.EndTime = 0
+item.FilePath = ""
+item.Progress = 0
+item.TotalSize = 0
+item.Speed = 0
+item.ErrorMessage = ""
+item.ErrorCode = ""
+item.RetryCount = 0
+item.AttemptCount = 0
+publishQueueEvent(EventItemRequeued, *item)
+triggerAutoStart()
+return nil
+}
+
+return fmt.Errorf("item %s not found", id)
+}
+
+// RetryItem puts a failed item back in the queue with a fresh set of attempts.
+func RetryItem(id string) error {
+downloadQueueLock.Lock()
+defer downloadQueueLock.Unlock()
+
+index := indexOfItemLocked(id)
+if index < 0 {
+return fmt.Errorf("item %s not found", id)
+}
+
+item := &downloadQueue[index]
+if item.Status != StatusFailed {
+return fmt.Errorf("item %s is not failed (status: %s)", id, item.Status)
+}
+
+item.Status = StatusQueued
+item.QueuedAt = getCurrentTimeMillis()
+item.QueueWaitSeconds = 0
+item.StartTime = 0
+item.StartedAtMillis = 0
+item.EndTime = 0
+item.Progress = 0
+item.Speed = 0
+item.ErrorMessage = ""
+item.ErrorCode = ""
+item.RetryCount = 0
+item.AttemptCount = 0
+publishQueueEvent(EventItemRequeued, *item)
+triggerAutoStart()
+return nil
+}
 
 func GetDownloadQueue() DownloadQueueInfo {
 
@@ -315,9 +1067,11 @@ sessionStartLock.RLock()
 sessionStart := sessionStartTime
 sessionStartLock.RUnlock()
 
-var queued, completed, failed, skipped int
+var queued, completed, failed, skipped, held int
 for _, item := range downloadQueue {
 switch item.Status {
+case StatusHeld:
+held++
 case StatusQueued:
 queued++
 case StatusCompleted:
@@ -332,16 +1086,30 @@ skipped++
 queueCopy := make([]DownloadItem, len(downloadQueue))
 copy(queueCopy, downloadQueue)
 
+now := getCurrentTimeMillis()
+for i := range queueCopy {
+queueCopy[i].EffectivePriority = effectivePriority(queueCopy[i], now)
+setDisplayProgress(&queueCopy[i])
+}
+
+overall, byCount, byBytes := overallProgressLocked()
+
 return DownloadQueueInfo{
-IsDownloading:    downloading,
-Queue:            queueCopy,
-CurrentSpeed:     speed,
-TotalDownloaded:  total,
-SessionStartTime: sessionStart,
-QueuedCount:      queued,
-CompletedCount:   completed,
-FailedCount:      failed,
-SkippedCount:     skipped,
+IsDownloading:       downloading,
+Queue:               queueCopy,
+CurrentSpeed:        speed,
+TotalDownloaded:     total,
+SessionStartTime:    sessionStart,
+QueuedCount:         queued,
+CompletedCount:      completed,
+FailedCount:         failed,
+SkippedCount:        skipped,
+HeldCount:           held,
+OverallProgress:     overall,
+ProgressByCount:     byCount,
+ProgressByBytes:     byBytes,
+RemainingUntilPause: remainingUntilPause(),
+SchedulePaused:      IsSchedulePaused(),
 }
 }
 
@@ -349,18 +1117,27 @@ func ClearDownloadQueue() {
 downloadQueueLock.Lock()
 defer downloadQueueLock.Unlock()
 
+stashClearLocked(false)
+
 newQueue := make([]DownloadItem, 0)
 for _, item := range downloadQueue {
-if item.Status == StatusQueued || item.Status == StatusDownloading {
+if item.Status == StatusQueued || item.Status == StatusDownloading || item.Status == StatusHeld || item.Pinned {
 newQueue = append(newQueue, item)
 }
 }
 downloadQueue = newQueue
+publishQueueEvent(EventQueueCleared, DownloadItem{})
 }
 
 func ClearAllDownloads() {
 downloadQueueLock.Lock()
+stashClearLocked(true)
 downloadQueue = []DownloadItem{}
+removedItems = nil
+resetCompletionCache()
+resetSourceBandwidth()
+replaceSessionMeta(nil)
+publishQueueEvent(EventQueueCleared, DownloadItem{})
 downloadQueueLock.Unlock()
 
 totalDownloadedLock.Lock()
@@ -369,6 +1146,7 @@ totalDownloadedLock.Unlock()
 
 sessionStartLock.Lock()
 sessionStartTime = 0
+resetSessionPauseLocked()
 sessionStartLock.Unlock()
 
 currentItemLock.Lock()
@@ -376,7 +1154,9 @@ currentItemID = ""
 currentItemLock.Unlock()
 
 SetDownloadProgress(0)
-SetDownloadSpeed(0)
+resetDownloadSpeed()
+resetAverageSpeed()
+resetItemBandwidthLimits()
 }
 
 func CancelAllQueuedItems() {
@@ -385,18 +1165,21 @@ defer downloadQueueLock.Unlock()
 
 for i := range downloadQueue {
 if downloadQueue[i].Status == StatusQueued {
+recordQueueWait(&downloadQueue[i])
 downloadQueue[i].Status = StatusSkipped
 downloadQueue[i].EndTime = time.Now().Unix()
 downloadQueue[i].ErrorMessage = "Cancelled"
+publishQueueEvent(EventItemSkipped, downloadQueue[i])
 }
 }
+evictHistoryLocked()
 }
 
 func ResetSessionIfComplete() {
 downloadQueueLock.RLock()
 hasActiveOrQueued := false
 for _, item := range downloadQueue {
-if item.Status == StatusQueued || item.Status == StatusDownloading {
+if item.Status == StatusQueued || item.Status == StatusDownloading || item.Status == StatusHeld {
 hasActiveOrQueued = true
 break
 }
@@ -406,6 +1189,7 @@ downloadQueueLock.RUnlock()
 if !hasActiveOrQueued {
 sessionStartLock.Lock()
 sessionStartTime = 0
+resetSessionPauseLocked()
 sessionStartLock.Unlock()
 
 totalDownloadedLock.Lock()
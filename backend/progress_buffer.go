@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const progressFlushInterval = 250 * time.Millisecond
+
+type progressSlot struct {
+	progress atomic.Uint64
+	speed    atomic.Uint64
+	wire     atomic.Int64
+	decoded  atomic.Int64
+	dirty    atomic.Bool
+}
+
+var (
+	pendingProgress    sync.Map
+	progressFlusherRun sync.Once
+)
+
+// UpdateItemProgress records the latest progress for an item without taking
+// the queue lock. A background flusher applies buffered values to the queue
+// and publishes progress events every progressFlushInterval.
+func UpdateItemProgress(id string, progress, speed float64) {
+	slot := progressSlotFor(id)
+	slot.progress.Store(math.Float64bits(progress))
+	slot.speed.Store(math.Float64bits(speed))
+	slot.dirty.Store(true)
+}
+
+func updateItemBytes(id string, wire, decoded int64) {
+	slot := progressSlotFor(id)
+	slot.wire.Store(wire)
+	slot.decoded.Store(decoded)
+	slot.dirty.Store(true)
+}
+
+func progressSlotFor(id string) *progressSlot {
+	if value, ok := pendingProgress.Load(id); ok {
+		return value.(*progressSlot)
+	}
+	value, _ := pendingProgress.LoadOrStore(id, &progressSlot{})
+	progressFlusherRun.Do(func() {
+		go runProgressFlusher()
+	})
+	return value.(*progressSlot)
+}
+
+func runProgressFlusher() {
+	ticker := time.NewTicker(progressFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushProgress()
+	}
+}
+
+// flushProgress leaves clean slots in place, since a writer may be storing
+// into one while it is checked; releaseItemStateLocked drops them once the
+// item has finished or left the queue.
+func flushProgress() {
+	updates := make(map[string]*progressSlot)
+	pendingProgress.Range(func(key, value interface{}) bool {
+		if slot := value.(*progressSlot); slot.dirty.Swap(false) {
+			updates[key.(string)] = slot
+		}
+		return true
+	})
+	if len(updates) == 0 {
+		return
+	}
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		slot, ok := updates[downloadQueue[i].ID]
+		if !ok || downloadQueue[i].Status != StatusDownloading {
+			continue
+		}
+		downloadQueue[i].Progress = math.Float64frombits(slot.progress.Load())
+		downloadQueue[i].Speed = math.Float64frombits(slot.speed.Load())
+		downloadQueue[i].WireBytes = slot.wire.Load()
+		downloadQueue[i].DecodedBytes = slot.decoded.Load()
+		publishQueueEvent(EventItemProgress, downloadQueue[i])
+	}
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flushedItem flushes buffered progress until the item satisfies done, since
+// the background flusher may take a slot's update before the test does.
+func flushedItem(t *testing.T, id string, done func(DownloadItem) bool) DownloadItem {
+	t.Helper()
+	deadline := time.Now().Add(2 * progressFlushInterval)
+	for {
+		flushProgress()
+		item := queueItem(t, id)
+		if done(item) || time.Now().After(deadline) {
+			return item
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushProgress(t *testing.T) {
+	tests := []struct {
+		name         string
+		start        bool
+		wantProgress float64
+		wantSpeed    float64
+	}{
+		{name: "downloading item takes the latest update", start: true, wantProgress: 3, wantSpeed: 1.5},
+		{name: "queued item is left alone", start: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			if tt.start {
+				startItem(t, "item")
+			} else if err := AddToQueue("item", "Track", "Artist", "Album", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			UpdateItemProgress("item", 1, 0.5)
+			UpdateItemProgress("item", 3, 1.5)
+			item := flushedItem(t, "item", func(item DownloadItem) bool {
+				return item.Progress == tt.wantProgress
+			})
+
+			if item.Progress != tt.wantProgress || item.Speed != tt.wantSpeed {
+				t.Errorf("progress, speed = %v, %v, want %v, %v", item.Progress, item.Speed, tt.wantProgress, tt.wantSpeed)
+			}
+		})
+	}
+}
+
+func TestProgressSlotKeptUntilItemFinishes(t *testing.T) {
+	resetQueueState(t)
+	startItem(t, "item")
+
+	UpdateItemProgress("item", 1, 1)
+	flushedItem(t, "item", func(item DownloadItem) bool { return item.Progress == 1 })
+	if _, ok := pendingProgress.Load("item"); !ok {
+		t.Fatal("clean slot of a downloading item was dropped")
+	}
+
+	CompleteDownloadItem("item", "", 1)
+	if _, ok := pendingProgress.Load("item"); ok {
+		t.Error("slot of a completed item was kept")
+	}
+}
+
+func TestProgressSlotDroppedOnRetry(t *testing.T) {
+	resetQueueState(t)
+	restore := maxRetries.Load()
+	SetMaxRetries(1)
+	t.Cleanup(func() { SetMaxRetries(int(restore)) })
+
+	startItem(t, "item")
+	UpdateItemProgress("item", 2, 1)
+	FailDownloadItemErr("item", newDownloadError("item", ErrorCategoryNetwork, errors.New("connection reset"), 0))
+
+	if got := queueItem(t, "item").Status; got != StatusQueued {
+		t.Fatalf("status = %s, want %s", got, StatusQueued)
+	}
+	if _, ok := pendingProgress.Load("item"); ok {
+		t.Error("slot of the failed attempt was kept after the item was requeued")
+	}
+}
+
+const benchmarkProgressWriters = 16
+
+// benchmarkProgress runs b.N progress updates spread over 16 writers, each
+// reporting for its own downloading item.
+func benchmarkProgress(b *testing.B, update func(id string, progress float64)) {
+	ClearAllDownloads()
+	b.Cleanup(ClearAllDownloads)
+	ids := make([]string, benchmarkProgressWriters)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("item-%d", i)
+		if err := AddToQueue(ids[i], "Track", "Artist", "Album", ""); err != nil {
+			b.Fatal(err)
+		}
+		if err := StartDownloadItem(ids[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < b.N/benchmarkProgressWriters; n++ {
+				update(id, float64(n))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkUpdateItemProgress(b *testing.B) {
+	b.Run("buffered", func(b *testing.B) {
+		benchmarkProgress(b, func(id string, progress float64) {
+			UpdateItemProgress(id, progress, 1)
+		})
+	})
+	// locked applies each update under the queue lock, as UpdateItemProgress
+	// did before updates were buffered.
+	b.Run("locked", func(b *testing.B) {
+		benchmarkProgress(b, func(id string, progress float64) {
+			downloadQueueLock.Lock()
+			if index := indexOfItemLocked(id); index >= 0 {
+				downloadQueue[index].Progress = progress
+				downloadQueue[index].Speed = 1
+				publishQueueEvent(EventItemProgress, downloadQueue[index])
+			}
+			downloadQueueLock.Unlock()
+		})
+	})
+}
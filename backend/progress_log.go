@@ -0,0 +1,252 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	progressLogFlushInterval = time.Second
+	defaultProgressLogStep   = 10
+)
+
+type progressLogEntry struct {
+	Timestamp  int64   `json:"timestamp"`
+	Event      string  `json:"event"`
+	ItemID     string  `json:"item_id"`
+	Track      string  `json:"track,omitempty"`
+	Artist     string  `json:"artist,omitempty"`
+	Status     string  `json:"status"`
+	ProgressMB float64 `json:"progress_mb"`
+	Percent    int     `json:"percent,omitempty"`
+	FilePath   string  `json:"file_path,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type progressLog struct {
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	maxSize int64
+	step    int
+	buckets map[string]int
+	stop    chan struct{}
+}
+
+var (
+	progressLogState = progressLog{step: defaultProgressLogStep}
+	progressLogLock  sync.Mutex
+	progressLogOpen  atomic.Bool
+)
+
+var progressLogEvents = map[QueueEventType]bool{
+	EventItemStarted:   true,
+	EventItemProgress:  true,
+	EventItemCompleted: true,
+	EventItemFailed:    true,
+	EventItemSkipped:   true,
+	EventItemRequeued:  true,
+}
+
+// SetProgressLogFile appends a JSON line to path for every start, completion,
+// failure and skip, and each time an item crosses another progress step.
+// Lines are buffered and flushed every second; CloseProgressLog flushes the
+// remainder. An empty path closes the current log.
+func SetProgressLogFile(path string) error {
+	progressLogLock.Lock()
+	defer progressLogLock.Unlock()
+
+	progressLogState.closeLocked()
+	if path == "" {
+		return nil
+	}
+
+	if err := progressLogState.openLocked(path); err != nil {
+		return err
+	}
+	progressLogState.buckets = make(map[string]int)
+	progressLogState.stop = make(chan struct{})
+	progressLogOpen.Store(true)
+	go runProgressLogFlusher(progressLogState.stop)
+	return nil
+}
+
+// SetProgressLogMaxSize rotates the progress log to "<path>.1" once it grows
+// past maxBytes. 0 disables rotation.
+func SetProgressLogMaxSize(maxBytes int64) {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	progressLogLock.Lock()
+	progressLogState.maxSize = maxBytes
+	progressLogLock.Unlock()
+}
+
+// SetProgressLogStep sets how many percentage points an item must advance
+// before another progress line is written. It defaults to 10.
+func SetProgressLogStep(percent int) {
+	if percent <= 0 || percent > 100 {
+		percent = defaultProgressLogStep
+	}
+	progressLogLock.Lock()
+	progressLogState.step = percent
+	progressLogLock.Unlock()
+}
+
+func CloseProgressLog() {
+	progressLogLock.Lock()
+	progressLogState.closeLocked()
+	progressLogLock.Unlock()
+}
+
+func runProgressLogFlusher(stop chan struct{}) {
+	ticker := time.NewTicker(progressLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			progressLogLock.Lock()
+			if progressLogState.writer != nil {
+				if err := progressLogState.writer.Flush(); err != nil {
+					fmt.Printf("Failed to flush progress log: %v\n", err)
+				}
+			}
+			progressLogLock.Unlock()
+		}
+	}
+}
+
+func logProgressEvent(eventType QueueEventType, item DownloadItem) {
+	if !progressLogEvents[eventType] || item.ID == "" {
+		return
+	}
+
+	progressLogLock.Lock()
+	defer progressLogLock.Unlock()
+
+	l := &progressLogState
+	if l.writer == nil {
+		return
+	}
+
+	entry := progressLogEntry{
+		Timestamp:  time.Now().UnixMilli(),
+		Event:      string(eventType),
+		ItemID:     item.ID,
+		Track:      item.TrackName,
+		Artist:     item.ArtistName,
+		Status:     string(item.Status),
+		ProgressMB: item.Progress,
+		FilePath:   item.FilePath,
+		Error:      item.ErrorMessage,
+	}
+
+	switch eventType {
+	case EventItemProgress:
+		if item.ExpectedSize <= 0 {
+			return
+		}
+		percent := int(item.Progress * bytesPerMiB * 100 / float64(item.ExpectedSize))
+		if percent > 100 {
+			percent = 100
+		}
+		bucket := percent / l.step * l.step
+		if bucket <= l.buckets[item.ID] {
+			return
+		}
+		l.buckets[item.ID] = bucket
+		entry.Percent = bucket
+	case EventItemStarted, EventItemRequeued:
+		delete(l.buckets, item.ID)
+	case EventItemCompleted:
+		delete(l.buckets, item.ID)
+		entry.Percent = 100
+		entry.ProgressMB = item.TotalSize
+	default:
+		delete(l.buckets, item.ID)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotateLocked(); err != nil {
+			fmt.Printf("Failed to rotate progress log: %v\n", err)
+			return
+		}
+	}
+
+	n, err := l.writer.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		fmt.Printf("Failed to write progress log: %v\n", err)
+	}
+}
+
+func (l *progressLog) openLocked(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.path = path
+	l.file = file
+	l.writer = bufio.NewWriter(file)
+	l.size = info.Size()
+	return nil
+}
+
+func (l *progressLog) rotateLocked() error {
+	path := l.path
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	l.writer = nil
+
+	renameErr := os.Rename(path, path+".1")
+	if err := l.openLocked(path); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (l *progressLog) closeLocked() {
+	progressLogOpen.Store(false)
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	if l.writer != nil {
+		if err := l.writer.Flush(); err != nil {
+			fmt.Printf("Failed to flush progress log: %v\n", err)
+		}
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = nil
+	l.writer = nil
+	l.path = ""
+	l.size = 0
+	l.buckets = nil
+}
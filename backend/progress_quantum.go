@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+var progressQuantumBits atomic.Uint64
+
+// SetProgressQuantum rounds the MBDownloaded reported by GetDownloadProgress
+// down to a multiple of mb, so fluctuations smaller than the quantum do not
+// show up as changes. 0, the default, reports the exact value, which is
+// always available from GetExactDownloadProgress.
+func SetProgressQuantum(mb float64) {
+	if mb < 0 || math.IsNaN(mb) || math.IsInf(mb, 0) {
+		mb = 0
+	}
+	progressQuantumBits.Store(math.Float64bits(mb))
+}
+
+func GetExactDownloadProgress() float64 {
+	currentProgressLock.RLock()
+	defer currentProgressLock.RUnlock()
+	return currentProgress
+}
+
+func progressQuantum() float64 {
+	return math.Float64frombits(progressQuantumBits.Load())
+}
+
+func quantizeProgress(mb float64) float64 {
+	quantum := progressQuantum()
+	if quantum <= 0 {
+		return mb
+	}
+	return math.Floor(mb/quantum) * quantum
+}
@@ -0,0 +1,302 @@
+package backend
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// resetQueueState empties the queue and session totals before and after the
+// test, since the queue is package state shared by every test.
+func resetQueueState(t *testing.T) {
+	t.Helper()
+	ClearAllDownloads()
+	t.Cleanup(ClearAllDownloads)
+}
+
+// startItem queues an item under id and marks it as downloading.
+func startItem(t *testing.T, id string) {
+	t.Helper()
+	if err := AddToQueue(id, "Track "+id, "Artist", "Album", ""); err != nil {
+		t.Fatalf("AddToQueue(%q): %v", id, err)
+	}
+	if err := StartDownloadItem(id); err != nil {
+		t.Fatalf("StartDownloadItem(%q): %v", id, err)
+	}
+}
+
+func queueItem(t *testing.T, id string) DownloadItem {
+	t.Helper()
+	item, ok := GetQueueItem(id)
+	if !ok {
+		t.Fatalf("item %q is not in the queue", id)
+	}
+	return item
+}
+
+// deleteFailedFiles switches the failure file action to delete for the test.
+func deleteFailedFiles(t *testing.T) {
+	t.Helper()
+	SetFailureFileAction(FailureFileDelete)
+	t.Cleanup(func() { SetFailureFileAction(FailureFileKeep) })
+}
+
+// writeDownload creates a file of size bytes standing in for a finished
+// download.
+func writeDownload(t *testing.T, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sessionTotal() float64 {
+	totalDownloadedLock.RLock()
+	defer totalDownloadedLock.RUnlock()
+	return totalDownloaded
+}
+
+func transitionCount(status DownloadStatus) int64 {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+	return statusTransitions[status]
+}
+
+func TestTerminalTransitionsAreIdempotent(t *testing.T) {
+	tests := []struct {
+		name      string
+		finish    func(id string)
+		want      DownloadStatus
+		wantTotal float64
+	}{
+		{
+			name:      "complete",
+			finish:    func(id string) { CompleteDownloadItem(id, "", 5) },
+			want:      StatusCompleted,
+			wantTotal: 5,
+		},
+		{
+			name:   "fail",
+			finish: func(id string) { FailDownloadItem(id, "connection reset") },
+			want:   StatusFailed,
+		},
+		{
+			name:   "skip",
+			finish: func(id string) { SkipDownloadItem(id, "") },
+			want:   StatusSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			startItem(t, "item")
+			before := transitionCount(tt.want)
+
+			tt.finish("item")
+			tt.finish("item")
+
+			if got := queueItem(t, "item").Status; got != tt.want {
+				t.Errorf("status = %s, want %s", got, tt.want)
+			}
+			if got := transitionCount(tt.want) - before; got != 1 {
+				t.Errorf("entered %s %d times, want 1", tt.want, got)
+			}
+			if got := sessionTotal(); got != tt.wantTotal {
+				t.Errorf("total downloaded = %v, want %v", got, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestCompleteEmptyDownload(t *testing.T) {
+	tests := []struct {
+		name         string
+		treatAsFail  bool
+		size         int
+		want         DownloadStatus
+		wantMessage  string
+		wantFileKept bool
+	}{
+		{name: "empty fails", treatAsFail: true, size: 0, want: StatusFailed, wantMessage: "Empty response"},
+		{name: "empty accepted", treatAsFail: false, size: 0, want: StatusCompleted, wantFileKept: true},
+		{name: "non-empty completes", treatAsFail: true, size: bytesPerMiB, want: StatusCompleted, wantFileKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			deleteFailedFiles(t)
+			SetTreatEmptyAsFailure(tt.treatAsFail)
+			t.Cleanup(func() { SetTreatEmptyAsFailure(true) })
+
+			path := writeDownload(t, tt.size)
+			startItem(t, "item")
+			CompleteDownloadItem("item", path, float64(tt.size)/bytesPerMiB)
+
+			item := queueItem(t, "item")
+			if item.Status != tt.want {
+				t.Errorf("status = %s, want %s", item.Status, tt.want)
+			}
+			if item.ErrorMessage != tt.wantMessage {
+				t.Errorf("error message = %q, want %q", item.ErrorMessage, tt.wantMessage)
+			}
+			if got := fileExists(path); got != tt.wantFileKept {
+				t.Errorf("file kept = %v, want %v", got, tt.wantFileKept)
+			}
+		})
+	}
+}
+
+func TestAddToQueueDuplicateID(t *testing.T) {
+	tests := []struct {
+		name          string
+		deterministic bool
+		add           func() (string, error)
+		wantErr       error
+		wantItems     int
+	}{
+		{
+			name: "caller ID reused",
+			add: func() (string, error) {
+				return "item", AddToQueue("item", "Track", "Artist", "Album", "spotify")
+			},
+			wantErr:   ErrDuplicateID,
+			wantItems: 1,
+		},
+		{
+			name: "generated IDs are unique",
+			add: func() (string, error) {
+				return AddToQueueAutoID("Track", "Artist", "Album", "spotify")
+			},
+			wantItems: 2,
+		},
+		{
+			name:          "deterministic ID of a pending item",
+			deterministic: true,
+			add: func() (string, error) {
+				return AddToQueueAutoID("Track", "Artist", "Album", "spotify")
+			},
+			wantErr:   ErrDuplicateID,
+			wantItems: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			SetDeterministicIDs(tt.deterministic)
+			t.Cleanup(func() { SetDeterministicIDs(false) })
+
+			first, err := tt.add()
+			if err != nil {
+				t.Fatalf("first add: %v", err)
+			}
+			second, err := tt.add()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("second add error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && second == first {
+				t.Errorf("both items got ID %q", first)
+			}
+			if got := len(GetDownloadQueue().Queue); got != tt.wantItems {
+				t.Errorf("queue has %d items, want %d", got, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestCompleteBelowMinValidFileSize(t *testing.T) {
+	const minSize = 16 * 1024
+	tests := []struct {
+		name        string
+		minSize     int64
+		size        int
+		expected    int64
+		want        DownloadStatus
+		wantMessage string
+	}{
+		{name: "tiny response fails", minSize: minSize, size: 2048, want: StatusFailed, wantMessage: "Response too small, likely an error page"},
+		{name: "tiny response below expected size fails", minSize: minSize, size: 2048, expected: 8 << 20, want: StatusFailed, wantMessage: "Response too small, likely an error page"},
+		{name: "small file of known size completes", minSize: minSize, size: 2048, expected: 2048, want: StatusCompleted},
+		{name: "file above the minimum completes", minSize: minSize, size: 64 * 1024, want: StatusCompleted},
+		{name: "check disabled", size: 2048, want: StatusCompleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			deleteFailedFiles(t)
+			SetMinValidFileSize(tt.minSize)
+			t.Cleanup(func() { SetMinValidFileSize(0) })
+
+			path := writeDownload(t, tt.size)
+			if err := AddToQueueFull(QueueRequest{ID: "item", TrackName: "Track", ExpectedSize: tt.expected}); err != nil {
+				t.Fatal(err)
+			}
+			if err := StartDownloadItem("item"); err != nil {
+				t.Fatal(err)
+			}
+			CompleteDownloadItem("item", path, float64(tt.size)/bytesPerMiB)
+
+			item := queueItem(t, "item")
+			if item.Status != tt.want {
+				t.Errorf("status = %s, want %s", item.Status, tt.want)
+			}
+			if item.ErrorMessage != tt.wantMessage {
+				t.Errorf("error message = %q, want %q", item.ErrorMessage, tt.wantMessage)
+			}
+			if kept, wantKept := fileExists(path), tt.want == StatusCompleted; kept != wantKept {
+				t.Errorf("file kept = %v, want %v", kept, wantKept)
+			}
+		})
+	}
+}
+
+func TestProgressWriterSpeedClock(t *testing.T) {
+	tests := []struct {
+		name      string
+		elapsed   int64
+		wantSpeed float64
+		sampled   bool
+	}{
+		{name: "clock moves forward", elapsed: 1000, wantSpeed: 1, sampled: true},
+		{name: "tiny delta is clamped", elapsed: 1, wantSpeed: 100, sampled: true},
+		{name: "clock stands still", elapsed: 0},
+		{name: "clock goes backward", elapsed: -5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := int64(60000)
+			restore := speedClock
+			speedClock = func() int64 { return now }
+			suppressInlineOutput.Store(true)
+			t.Cleanup(func() {
+				speedClock = restore
+				suppressInlineOutput.Store(false)
+				resetDownloadSpeed()
+			})
+
+			pw := NewProgressWriter(io.Discard)
+			now += tt.elapsed
+			if _, err := pw.Write(make([]byte, bytesPerMiB)); err != nil {
+				t.Fatal(err)
+			}
+
+			speedLock.RLock()
+			speed, ok := writerSpeeds[pw.id]
+			speedLock.RUnlock()
+			if ok != tt.sampled || speed != tt.wantSpeed {
+				t.Errorf("speed = %v (sampled %v), want %v (sampled %v)", speed, ok, tt.wantSpeed, tt.sampled)
+			}
+			if sampled := pw.lastBytes == pw.total; sampled != tt.sampled {
+				t.Errorf("bytes carried into the next sample = %v, want %v", !sampled, !tt.sampled)
+			}
+		})
+	}
+}
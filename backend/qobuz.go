@@ -14,8 +14,10 @@ import (
 )
 
 type QobuzDownloader struct {
-	client *http.Client
-	appID  string
+	client     *http.Client
+	appID      string
+	itemID     string
+	outputPath string
 }
 
 type QobuzSearchResponse struct {
@@ -77,6 +79,16 @@ func NewQobuzDownloader() *QobuzDownloader {
 	}
 }
 
+func (q *QobuzDownloader) SetItemID(itemID string) {
+	q.itemID = itemID
+}
+
+// SetOutputPath makes the downloader write to path, the one planned for the
+// item, instead of the path built from the filename format.
+func (q *QobuzDownloader) SetOutputPath(path string) {
+	q.outputPath = path
+}
+
 func (q *QobuzDownloader) searchByISRC(isrc string) (*QobuzTrack, error) {
 	apiBase := "https://www.qobuz.com/api.json/0.2/track/search?query="
 	url := fmt.Sprintf("%s%s&limit=1&app_id=%s", apiBase, isrc, q.appID)
@@ -238,35 +250,59 @@ func (q *QobuzDownloader) GetDownloadURL(trackID int64, quality string, allowFal
 }
 
 func (q *QobuzDownloader) DownloadFile(url, filepath string) error {
+	return downloadViaTempFile(q.itemID, filepath, func(target string) error {
+		return q.downloadFile(url, target)
+	})
+}
+
+func (q *QobuzDownloader) downloadFile(url, filepath string) error {
 	fmt.Println("Starting file download...")
 
 	downloadClient := &http.Client{
 		Timeout: 5 * time.Minute,
 	}
 
-	resp, err := downloadClient.Get(url)
+	prepare := withItemHeaders(q.itemID, nil)
+	if handled, err := resumeDownload(downloadClient, url, filepath, q.itemID, prepare); handled {
+		return err
+	}
+	if handled, err := downloadSegmented(downloadClient, url, filepath, q.itemID, prepare); handled {
+		return err
+	}
+
+	req, err := newItemDownloadRequest(q.itemID, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	prepare(req)
+
+	resp, err := downloadClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+		return transferError(q.itemID, fmt.Errorf("failed to download file: %w", err), 0)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+		return statusError(q.itemID, resp.StatusCode, fmt.Errorf("download failed with status %d", resp.StatusCode))
 	}
 
 	fmt.Printf("Creating file: %s\n", filepath)
 	out, err := os.Create(filepath)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return transferError(q.itemID, fmt.Errorf("failed to create file: %w", err), 0)
 	}
 	defer out.Close()
 
 	fmt.Println("Downloading...")
 
-	pw := NewProgressWriter(out)
-	_, err = io.Copy(pw, resp.Body)
+	pw := NewProgressWriterWithID(out, q.itemID)
+
+	_, err = io.Copy(pw, pw.ResponseBody(resp))
+	if finishErr := pw.Finish(); err == nil {
+		err = finishErr
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return transferError(q.itemID, fmt.Errorf("failed to write file: %w", err), pw.GetTotal())
 	}
 
 	fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
@@ -388,10 +424,8 @@ func (q *QobuzDownloader) DownloadTrackWithISRC(deezerISRC, spotifyID, outputDir
 		close(metaChan)
 	}
 
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create output directory: %w", err)
-		}
+	if err := ensureOutputDir(outputDir); err != nil {
+		return "", err
 	}
 
 	track, err := q.searchByISRC(deezerISRC)
@@ -440,7 +474,7 @@ func (q *QobuzDownloader) DownloadTrackWithISRC(deezerISRC, spotifyID, outputDir
 	safeAlbum := sanitizeFilename(albumTitle)
 
 	filename := buildQobuzFilename(safeTitle, safeArtist, safeAlbum, safeAlbumArtist, spotifyReleaseDate, spotifyTrackNumber, spotifyDiscNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	filepath := filepath.Join(outputDir, filename)
+	filepath := plannedOutputPath(q.outputPath, filepath.Join(outputDir, filename))
 
 	if fileInfo, err := os.Stat(filepath); err == nil && fileInfo.Size() > 0 {
 		fmt.Printf("File already exists: %s (%.2f MB)\n", filepath, float64(fileInfo.Size())/(1024*1024))
@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const autoSaveDebounce = 2 * time.Second
+
+type autoSaver struct {
+	path    string
+	trigger chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	activeAutoSaver atomic.Pointer[autoSaver]
+	autoSaveLock    sync.Mutex
+)
+
+// EnableAutoSave saves the queue to path every interval and shortly after any
+// item completes, fails or is skipped, coalescing bursts of changes into a
+// single write. Saves run one at a time on a background goroutine and replace
+// the file atomically. Enabling again replaces the previous schedule.
+func EnableAutoSave(path string, interval time.Duration) {
+	autoSaveLock.Lock()
+	defer autoSaveLock.Unlock()
+
+	stopAutoSaveLocked()
+	if path == "" || interval <= 0 {
+		return
+	}
+
+	saver := &autoSaver{
+		path:    path,
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	activeAutoSaver.Store(saver)
+	go saver.run(interval)
+}
+
+// DisableAutoSave stops auto-saving and waits for a save in progress to
+// finish.
+func DisableAutoSave() {
+	autoSaveLock.Lock()
+	stopAutoSaveLocked()
+	autoSaveLock.Unlock()
+}
+
+func stopAutoSaveLocked() {
+	saver := activeAutoSaver.Swap(nil)
+	if saver == nil {
+		return
+	}
+	close(saver.stop)
+	<-saver.done
+}
+
+func notifyAutoSave(eventType QueueEventType) {
+	switch eventType {
+	case EventItemCompleted, EventItemFailed, EventItemSkipped:
+	default:
+		return
+	}
+	saver := activeAutoSaver.Load()
+	if saver == nil {
+		return
+	}
+	select {
+	case saver.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *autoSaver) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var debounce *time.Timer
+	var debounceC <-chan time.Time
+	for {
+		select {
+		case <-s.stop:
+			if debounce != nil {
+				debounce.Stop()
+			}
+			return
+		case <-s.trigger:
+			if debounce == nil {
+				debounce = time.NewTimer(autoSaveDebounce)
+				debounceC = debounce.C
+			}
+		case <-debounceC:
+			debounce, debounceC = nil, nil
+			s.save()
+		case <-ticker.C:
+			s.save()
+		}
+	}
+}
+
+func (s *autoSaver) save() {
+	if err := SaveQueueToFile(s.path); err != nil {
+		fmt.Printf("Failed to auto-save queue: %v\n", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so a crash mid-write leaves the previous file intact.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config captures the queue's tunable settings so a preset can be saved,
+// shared as JSON and restored in one call.
+type Config struct {
+	MaxConcurrentDownloads  int               `json:"max_concurrent_downloads"`
+	AutoStart               bool              `json:"auto_start"`
+	BandwidthLimit          int64             `json:"bandwidth_limit"`
+	MaxConcurrentWrites     int               `json:"max_concurrent_writes"`
+	MaxRetries              int               `json:"max_retries"`
+	DispatchStrategy        DispatchStrategy  `json:"dispatch_strategy"`
+	SourceWeights           map[string]int    `json:"source_weights,omitempty"`
+	PriorityAging           int               `json:"priority_aging"`
+	DuplicatePolicy         DuplicatePolicy   `json:"duplicate_policy"`
+	MaxQueueSize            int               `json:"max_queue_size"`
+	MaxHistory              int               `json:"max_history"`
+	QueueTTL                time.Duration     `json:"queue_ttl"`
+	SkipIfCompletedWithin   time.Duration     `json:"skip_if_completed_within"`
+	DeterministicIDs        bool              `json:"deterministic_ids"`
+	CollisionStrategy       CollisionStrategy `json:"collision_strategy"`
+	FailureFileAction       FailureFileAction `json:"failure_file_action"`
+	OrphanAction            OrphanAction      `json:"orphan_action"`
+	TreatEmptyAsFailure     bool              `json:"treat_empty_as_failure"`
+	MinValidFileSize        int64             `json:"min_valid_file_size"`
+	RedownloadDeletesFile   bool              `json:"redownload_deletes_file"`
+	ResumePartialDownloads  bool              `json:"resume_partial_downloads"`
+	ResumeVerification      bool              `json:"resume_verification"`
+	ParallelSegments        int               `json:"parallel_segments"`
+	CopyBufferSize          int               `json:"copy_buffer_size"`
+	DefaultHeaders          map[string]string `json:"default_headers,omitempty"`
+	AdaptiveReporting       bool              `json:"adaptive_reporting"`
+	ProgressSteps           int               `json:"progress_steps"`
+	ProgressQuantum         float64           `json:"progress_quantum"`
+	OverallProgressMode     ProgressMode      `json:"overall_progress_mode"`
+	TrackStateHistory       bool              `json:"track_state_history"`
+	UseTempFiles            bool              `json:"use_temp_files"`
+	CreateDirs              bool              `json:"create_dirs"`
+	MaxBufferMemory         int64             `json:"max_buffer_memory"`
+	ContentDedup            bool              `json:"content_dedup"`
+	AutoPauseAfter          int               `json:"auto_pause_after"`
+	Schedule                []TimeWindow      `json:"schedule,omitempty"`
+	SchedulePausesActive    bool              `json:"schedule_pauses_active"`
+	ImportsCountTowardTotal bool              `json:"imports_count_toward_total"`
+	// SpeedAlert is the SetSpeedAlert threshold in MB/s. The callback cannot
+	// be serialized, so a non-zero threshold keeps the one already set.
+	SpeedAlert         float64       `json:"speed_alert"`
+	SamplerIdleTimeout time.Duration `json:"sampler_idle_timeout"`
+}
+
+// GetConfig returns the current value of every setting in Config.
+func GetConfig() Config {
+	cfg := Config{
+		MaxConcurrentDownloads:  int(maxConcurrentDownloads.Load()),
+		AutoStart:               !autoStartDisabled.Load(),
+		MaxConcurrentWrites:     int(maxConcurrentWrites.Load()),
+		MaxRetries:              int(maxRetries.Load()),
+		PriorityAging:           int(priorityAgingRate.Load()),
+		MaxHistory:              int(maxHistoryItems.Load()),
+		SkipIfCompletedWithin:   time.Duration(skipCompletedWithin.Load()),
+		DeterministicIDs:        deterministicIDs.Load(),
+		TreatEmptyAsFailure:     !acceptEmptyDownloads.Load(),
+		MinValidFileSize:        minValidFileSize.Load(),
+		RedownloadDeletesFile:   redownloadDeletesFile.Load(),
+		ResumePartialDownloads:  resumePartialDownloads.Load(),
+		ResumeVerification:      !resumeVerificationDisabled.Load(),
+		ParallelSegments:        int(parallelSegments.Load()),
+		CopyBufferSize:          int(copyBufferSize.Load()),
+		AdaptiveReporting:       adaptiveReporting.Load(),
+		ProgressSteps:           int(progressSteps.Load()),
+		ProgressQuantum:         progressQuantum(),
+		TrackStateHistory:       trackStateHistory.Load(),
+		UseTempFiles:            !tempFilesDisabled.Load(),
+		CreateDirs:              !dontCreateDirs.Load(),
+		ContentDedup:            contentDedup.Load(),
+		AutoPauseAfter:          int(autoPauseAfter.Load()),
+		Schedule:                GetSchedule(),
+		SchedulePausesActive:    schedulePausesActive.Load(),
+		ImportsCountTowardTotal: importsCountTowardTotal.Load(),
+	}
+	_, cfg.MaxBufferMemory = GetBufferMemory()
+	cfg.SpeedAlert, _ = speedAlertConfig()
+
+	samplerLock.Lock()
+	cfg.SamplerIdleTimeout = samplerIdleTimeout
+	samplerLock.Unlock()
+
+	globalLimiter.mu.Lock()
+	cfg.BandwidthLimit = globalLimiter.rate
+	globalLimiter.mu.Unlock()
+
+	dispatchLock.Lock()
+	cfg.DispatchStrategy = dispatchStrategy
+	if len(sourceWeights) > 0 {
+		cfg.SourceWeights = make(map[string]int, len(sourceWeights))
+		for source, weight := range sourceWeights {
+			cfg.SourceWeights[source] = weight
+		}
+	}
+	dispatchLock.Unlock()
+
+	queuePolicyLock.RLock()
+	cfg.DuplicatePolicy = duplicatePolicy
+	cfg.MaxQueueSize = maxQueueSize
+	queuePolicyLock.RUnlock()
+
+	queueTTLLock.Lock()
+	cfg.QueueTTL = queueTTL
+	queueTTLLock.Unlock()
+
+	collisionStrategyLock.RLock()
+	cfg.CollisionStrategy = collisionStrategy
+	collisionStrategyLock.RUnlock()
+
+	failureFileActionLock.RLock()
+	cfg.FailureFileAction = failureFileAction
+	failureFileActionLock.RUnlock()
+
+	orphanActionLock.RLock()
+	cfg.OrphanAction = orphanAction
+	orphanActionLock.RUnlock()
+
+	defaultHeadersLock.RLock()
+	cfg.DefaultHeaders = copyHeaders(defaultHeaders)
+	defaultHeadersLock.RUnlock()
+
+	overallProgressModeLock.RLock()
+	cfg.OverallProgressMode = overallProgressMode
+	overallProgressModeLock.RUnlock()
+
+	return cfg
+}
+
+// Validate reports the first setting in cfg that its setter would reject or
+// clamp. Empty strategies, policies, actions and modes are allowed
+// and select the default.
+func (cfg Config) Validate() error {
+	counts := []struct {
+		name  string
+		value int64
+	}{
+		{"max concurrent downloads", int64(cfg.MaxConcurrentDownloads)},
+		{"bandwidth limit", cfg.BandwidthLimit},
+		{"max concurrent writes", int64(cfg.MaxConcurrentWrites)},
+		{"max retries", int64(cfg.MaxRetries)},
+		{"priority aging", int64(cfg.PriorityAging)},
+		{"max queue size", int64(cfg.MaxQueueSize)},
+		{"max history", int64(cfg.MaxHistory)},
+		{"queue TTL", int64(cfg.QueueTTL)},
+		{"skip if completed within", int64(cfg.SkipIfCompletedWithin)},
+		{"min valid file size", cfg.MinValidFileSize},
+		{"parallel segments", int64(cfg.ParallelSegments)},
+		{"progress steps", int64(cfg.ProgressSteps)},
+		{"max buffer memory", cfg.MaxBufferMemory},
+		{"auto pause after", int64(cfg.AutoPauseAfter)},
+		{"sampler idle timeout", int64(cfg.SamplerIdleTimeout)},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", c.name, c.value)
+		}
+	}
+
+	switch cfg.DispatchStrategy {
+	case "", DispatchFIFO, DispatchLargestFirst, DispatchSmallestFirst, DispatchPriority:
+	default:
+		return fmt.Errorf("unknown dispatch strategy %q", cfg.DispatchStrategy)
+	}
+	for source, weight := range cfg.SourceWeights {
+		if weight <= 0 {
+			return fmt.Errorf("source weight for %q must be positive, got %d", source, weight)
+		}
+	}
+	switch cfg.DuplicatePolicy {
+	case "", DuplicateAllow, DuplicateSkipActive, DuplicateSkipAny:
+	default:
+		return fmt.Errorf("unknown duplicate policy %q", cfg.DuplicatePolicy)
+	}
+	switch cfg.CollisionStrategy {
+	case "", CollisionOverwrite, CollisionRename, CollisionSkip:
+	default:
+		return fmt.Errorf("unknown collision strategy %q", cfg.CollisionStrategy)
+	}
+	switch cfg.FailureFileAction.Mode {
+	case "", FailureFileKeepMode, FailureFileDeleteMode:
+	case FailureFileQuarantineMode:
+		if cfg.FailureFileAction.Dir == "" {
+			return fmt.Errorf("failure file action %q needs a directory", cfg.FailureFileAction.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown failure file action %q", cfg.FailureFileAction.Mode)
+	}
+	switch cfg.OrphanAction {
+	case "", OrphanRequeue, OrphanFail:
+	default:
+		return fmt.Errorf("unknown orphan action %q", cfg.OrphanAction)
+	}
+	switch cfg.OverallProgressMode {
+	case "", ProgressAuto, ProgressByCount, ProgressByBytes:
+	default:
+		return fmt.Errorf("unknown overall progress mode %q", cfg.OverallProgressMode)
+	}
+
+	if cfg.CopyBufferSize != 0 && (cfg.CopyBufferSize < minCopyBufferSize || cfg.CopyBufferSize > maxCopyBufferSize) {
+		return fmt.Errorf("copy buffer size %d is outside the allowed range %d-%d", cfg.CopyBufferSize, minCopyBufferSize, maxCopyBufferSize)
+	}
+	for name, value := range cfg.DefaultHeaders {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid default header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("default header %s has a line break in its value", name)
+		}
+	}
+	if cfg.ProgressQuantum < 0 || math.IsNaN(cfg.ProgressQuantum) || math.IsInf(cfg.ProgressQuantum, 0) {
+		return fmt.Errorf("progress quantum must be a non-negative number, got %v", cfg.ProgressQuantum)
+	}
+	if err := validateSchedule(cfg.Schedule); err != nil {
+		return err
+	}
+	if cfg.SpeedAlert < 0 || math.IsNaN(cfg.SpeedAlert) || math.IsInf(cfg.SpeedAlert, 0) {
+		return fmt.Errorf("speed alert threshold must be a non-negative number, got %v", cfg.SpeedAlert)
+	}
+	if _, callback := speedAlertConfig(); cfg.SpeedAlert > 0 && callback == nil {
+		return fmt.Errorf("speed alert threshold needs a callback set with SetSpeedAlert")
+	}
+	return nil
+}
+
+// ApplyConfig sets every setting in cfg, so fields left at their zero value
+// are applied as such; start from GetConfig to change only some of them. The
+// config is checked with Validate before anything is changed. The schedule
+// and auto-pause limit are only applied when they differ from the current
+// ones, so restoring a preset neither restarts the schedule nor resets the
+// auto-pause batch. Settings take effect for subsequent dispatch decisions;
+// downloads already running keep going.
+func ApplyConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.DispatchStrategy == "" {
+		cfg.DispatchStrategy = DispatchFIFO
+	}
+	if cfg.DuplicatePolicy == "" {
+		cfg.DuplicatePolicy = DuplicateAllow
+	}
+	if cfg.CollisionStrategy == "" {
+		cfg.CollisionStrategy = CollisionRename
+	}
+	if cfg.FailureFileAction.Mode == "" {
+		cfg.FailureFileAction = FailureFileKeep
+	}
+	if cfg.OrphanAction == "" {
+		cfg.OrphanAction = OrphanRequeue
+	}
+	if cfg.OverallProgressMode == "" {
+		cfg.OverallProgressMode = ProgressAuto
+	}
+
+	SetBandwidthLimit(cfg.BandwidthLimit)
+	SetMaxConcurrentWrites(cfg.MaxConcurrentWrites)
+	SetMaxRetries(cfg.MaxRetries)
+	SetDispatchStrategy(cfg.DispatchStrategy)
+	SetSourceWeights(cfg.SourceWeights)
+	SetPriorityAging(cfg.PriorityAging)
+	SetDuplicatePolicy(cfg.DuplicatePolicy)
+	SetMaxQueueSize(cfg.MaxQueueSize)
+	SetMaxHistory(cfg.MaxHistory)
+	SetQueueTTL(cfg.QueueTTL)
+	SetSkipIfCompletedWithin(cfg.SkipIfCompletedWithin)
+	SetDeterministicIDs(cfg.DeterministicIDs)
+	SetCollisionStrategy(cfg.CollisionStrategy)
+	SetFailureFileAction(cfg.FailureFileAction)
+	SetOrphanAction(cfg.OrphanAction)
+	SetTreatEmptyAsFailure(cfg.TreatEmptyAsFailure)
+	SetMinValidFileSize(cfg.MinValidFileSize)
+	SetRedownloadDeletesFile(cfg.RedownloadDeletesFile)
+	SetResumePartialDownloads(cfg.ResumePartialDownloads)
+	SetResumeVerification(cfg.ResumeVerification)
+	SetParallelSegments(cfg.ParallelSegments)
+	SetCopyBufferSize(cfg.CopyBufferSize)
+	SetDefaultHeaders(cfg.DefaultHeaders)
+	SetAdaptiveReporting(cfg.AdaptiveReporting)
+	SetProgressSteps(cfg.ProgressSteps)
+	SetProgressQuantum(cfg.ProgressQuantum)
+	SetOverallProgressMode(cfg.OverallProgressMode)
+	SetTrackStateHistory(cfg.TrackStateHistory)
+	SetUseTempFiles(cfg.UseTempFiles)
+	SetCreateDirs(cfg.CreateDirs)
+	SetMaxBufferMemory(cfg.MaxBufferMemory)
+	SetContentDedup(cfg.ContentDedup)
+	SetSchedulePausesActive(cfg.SchedulePausesActive)
+	SetImportsCountTowardTotal(cfg.ImportsCountTowardTotal)
+	SetSamplerIdleTimeout(cfg.SamplerIdleTimeout)
+	if threshold, callback := speedAlertConfig(); cfg.SpeedAlert != threshold {
+		SetSpeedAlert(cfg.SpeedAlert, callback)
+	}
+	if cfg.AutoPauseAfter != int(autoPauseAfter.Load()) {
+		SetAutoPauseAfter(cfg.AutoPauseAfter)
+	}
+	if !slices.Equal(cfg.Schedule, GetSchedule()) {
+		if err := SetSchedule(cfg.Schedule); err != nil {
+			return err
+		}
+	}
+
+	// Dispatch settings go last so the items they release are picked with
+	// the rest of the config already in place.
+	SetAutoStart(cfg.AutoStart)
+	SetMaxConcurrentDownloads(cfg.MaxConcurrentDownloads)
+	return nil
+}
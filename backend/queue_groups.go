@@ -0,0 +1,133 @@
+package backend
+
+import "sync"
+
+const bytesPerMiB = 1024 * 1024
+
+type ProgressMode string
+
+const (
+	ProgressAuto    ProgressMode = "auto"
+	ProgressByCount ProgressMode = "by_count"
+	ProgressByBytes ProgressMode = "by_bytes"
+)
+
+var (
+	overallProgressMode     = ProgressAuto
+	overallProgressModeLock sync.RWMutex
+)
+
+// SetOverallProgressMode chooses how DownloadQueueInfo.OverallProgress is
+// computed. ProgressAuto, the default, weights by bytes when every item has a
+// known size and by item count otherwise.
+func SetOverallProgressMode(mode ProgressMode) {
+	overallProgressModeLock.Lock()
+	overallProgressMode = mode
+	overallProgressModeLock.Unlock()
+}
+
+func GetGroupProgress(albumName string) (done, total int, bytesDone, bytesTotal int64) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	for _, item := range downloadQueue {
+		if item.AlbumName != albumName {
+			continue
+		}
+		total++
+
+		downloaded, expected, finished := itemByteProgress(item)
+		if finished {
+			done++
+		}
+		bytesDone += downloaded
+		bytesTotal += expected
+	}
+	return done, total, bytesDone, bytesTotal
+}
+
+func itemByteProgress(item DownloadItem) (downloaded, expected int64, finished bool) {
+	downloaded = int64(item.Progress * bytesPerMiB)
+	expected = knownItemSize(item)
+
+	switch item.Status {
+	case StatusCompleted:
+		finished = true
+		downloaded = int64(item.TotalSize * bytesPerMiB)
+		if expected <= 0 {
+			expected = downloaded
+		}
+	case StatusSkipped:
+		finished = true
+		downloaded = expected
+	}
+	return downloaded, expected, finished
+}
+
+// setDisplayProgress fills in Percent and Indeterminate from the item's
+// current expected size, so they follow a size learned mid-download. Percent
+// is -1 while the size is unknown.
+func setDisplayProgress(item *DownloadItem) {
+	downloaded, expected, finished := itemByteProgress(*item)
+	item.Indeterminate = !finished && expected <= 0
+
+	switch {
+	case finished:
+		item.Percent = 100
+	case item.Indeterminate:
+		item.Percent = -1
+	default:
+		item.Percent = float64(downloaded) * 100 / float64(expected)
+		if item.Percent > 100 {
+			item.Percent = 100
+		}
+	}
+}
+
+func overallProgressLocked() (overall, byCount, byBytes float64) {
+	var done, total int
+	var bytesDone, bytesTotal int64
+	sizesKnown := true
+	for _, item := range downloadQueue {
+		if item.Status == StatusFailed {
+			continue
+		}
+		total++
+
+		downloaded, expected, finished := itemByteProgress(item)
+		if finished {
+			done++
+		}
+		if expected <= 0 && item.Status != StatusSkipped {
+			sizesKnown = false
+		}
+		bytesDone += downloaded
+		bytesTotal += expected
+	}
+
+	if total > 0 {
+		byCount = float64(done) / float64(total)
+	}
+	if bytesTotal > 0 {
+		byBytes = float64(bytesDone) / float64(bytesTotal)
+		if byBytes > 1 {
+			byBytes = 1
+		}
+	}
+
+	overallProgressModeLock.RLock()
+	mode := overallProgressMode
+	overallProgressModeLock.RUnlock()
+
+	switch {
+	case mode == ProgressByBytes:
+		overall = byBytes
+	case mode == ProgressByCount:
+		overall = byCount
+	case sizesKnown && bytesTotal > 0:
+		overall = byBytes
+	default:
+		overall = byCount
+	}
+	return overall, byCount, byBytes
+}
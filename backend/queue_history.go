@@ -0,0 +1,172 @@
+package backend
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var maxHistoryItems atomic.Int64
+
+func isTerminalStatus(status DownloadStatus) bool {
+	return status == StatusCompleted || status == StatusFailed || status == StatusSkipped
+}
+
+func SetMaxHistory(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	maxHistoryItems.Store(int64(limit))
+
+	downloadQueueLock.Lock()
+	evictHistoryLocked()
+	downloadQueueLock.Unlock()
+}
+
+func evictHistoryLocked() {
+	limit := int(maxHistoryItems.Load())
+	if limit == 0 {
+		return
+	}
+
+	evictable := 0
+	for _, item := range downloadQueue {
+		if isTerminalStatus(item.Status) && !item.Pinned {
+			evictable++
+		}
+	}
+	if evictable <= limit {
+		return
+	}
+
+	for evictable > limit {
+		oldest := -1
+		for i, item := range downloadQueue {
+			if !isTerminalStatus(item.Status) || item.Pinned {
+				continue
+			}
+			if oldest == -1 || item.EndTime < downloadQueue[oldest].EndTime {
+				oldest = i
+			}
+		}
+		removed := downloadQueue[oldest]
+		downloadQueue = append(downloadQueue[:oldest], downloadQueue[oldest+1:]...)
+		publishQueueEvent(EventItemRemoved, removed)
+		evictable--
+	}
+}
+
+func PinItem(id string) error {
+	return setItemPinned(id, true)
+}
+
+func UnpinItem(id string) error {
+	return setItemPinned(id, false)
+}
+
+func setItemPinned(id string, pinned bool) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].Pinned = pinned
+			if !pinned {
+				evictHistoryLocked()
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("item %s not found", id)
+}
+
+func RemoveQueueItem(id string) bool {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			removed := downloadQueue[i]
+			downloadQueue = append(downloadQueue[:i], downloadQueue[i+1:]...)
+			publishQueueEvent(EventItemRemoved, removed)
+			return true
+		}
+	}
+	return false
+}
+
+var removedItems []DownloadItem
+
+func SoftRemoveItem(id string) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID != id {
+			continue
+		}
+		if downloadQueue[i].Status == StatusDownloading {
+			return fmt.Errorf("item %s is currently downloading", id)
+		}
+
+		removed := downloadQueue[i]
+		downloadQueue = append(downloadQueue[:i], downloadQueue[i+1:]...)
+		removedItems = append(removedItems, removed)
+		publishQueueEvent(EventItemRemoved, removed)
+		return nil
+	}
+	return fmt.Errorf("item %s not found", id)
+}
+
+func GetRemovedItems() []DownloadItem {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	items := make([]DownloadItem, len(removedItems))
+	copy(items, removedItems)
+	return items
+}
+
+func RestoreItem(id string) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range removedItems {
+		if removedItems[i].ID != id {
+			continue
+		}
+
+		restored := removedItems[i]
+		if indexOfItemLocked(restored.ID) >= 0 {
+			return ErrDuplicateID
+		}
+		removedItems = append(removedItems[:i], removedItems[i+1:]...)
+		downloadQueue = append(downloadQueue, restored)
+		publishQueueEvent(EventItemAdded, restored)
+		return nil
+	}
+	return fmt.Errorf("removed item %s not found", id)
+}
+
+// compactSlack is how much unused capacity the queue's backing array may
+// carry before CompactQueue reallocates it.
+const compactSlack = 64
+
+// CompactQueue reallocates the queue into a right-sized backing array,
+// releasing the items that earlier removals left behind in its spare
+// capacity, and drops soft-removed items, which can then no longer be
+// restored. It returns false when there was nothing to reclaim. Items keep
+// their order, so lookups by ID are unaffected.
+func CompactQueue() bool {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	if cap(downloadQueue)-len(downloadQueue) <= compactSlack && len(removedItems) == 0 {
+		return false
+	}
+
+	compacted := make([]DownloadItem, len(downloadQueue))
+	copy(compacted, downloadQueue)
+	downloadQueue = compacted
+	removedItems = nil
+	return true
+}
@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+)
+
+func PrioritizeAlbum(albumName string) int {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	var slots []int
+	var album, others []DownloadItem
+	for i, item := range downloadQueue {
+		if item.Status != StatusQueued {
+			continue
+		}
+		slots = append(slots, i)
+		if item.AlbumName == albumName {
+			album = append(album, item)
+		} else {
+			others = append(others, item)
+		}
+	}
+
+	if len(album) == 0 {
+		return 0
+	}
+
+	moved := 0
+	for i, item := range append(album, others...) {
+		if downloadQueue[slots[i]].ID != item.ID && item.AlbumName == albumName {
+			moved++
+		}
+		downloadQueue[slots[i]] = item
+	}
+	if moved > 0 {
+		publishQueueEvent(EventQueueReordered, DownloadItem{})
+	}
+	return moved
+}
+
+func HoldItem(id string) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		return fmt.Errorf("item %s not found", id)
+	}
+	item := &downloadQueue[index]
+	if item.Status != StatusQueued {
+		return fmt.Errorf("item %s is %s, only queued items can be held", id, item.Status)
+	}
+
+	item.Status = StatusHeld
+	publishQueueEvent(EventItemHeld, *item)
+	return nil
+}
+
+func ReleaseItem(id string) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		return fmt.Errorf("item %s not found", id)
+	}
+	item := &downloadQueue[index]
+	if item.Status != StatusHeld {
+		return fmt.Errorf("item %s is not held", id)
+	}
+
+	item.Status = StatusQueued
+	publishQueueEvent(EventItemReleased, *item)
+	triggerAutoStart()
+	return nil
+}
+
+// ReplaceQueue swaps in a reordered copy of the queue. The items must have
+// exactly the IDs currently queued, otherwise an error is returned and the
+// caller should re-sync. Only the order is taken from items; every item keeps
+// its live state, so progress made since the caller's copy was taken is not
+// lost.
+func ReplaceQueue(items []DownloadItem) error {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	if len(items) != len(downloadQueue) {
+		return fmt.Errorf("queue has %d items, got %d", len(downloadQueue), len(items))
+	}
+
+	current := make(map[string]DownloadItem, len(downloadQueue))
+	for _, item := range downloadQueue {
+		current[item.ID] = item
+	}
+
+	replaced := make([]DownloadItem, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		existing, ok := current[item.ID]
+		if !ok {
+			return fmt.Errorf("item %s is not in the queue", item.ID)
+		}
+		if seen[item.ID] {
+			return fmt.Errorf("item %s appears more than once", item.ID)
+		}
+		seen[item.ID] = true
+
+		replaced = append(replaced, existing)
+	}
+
+	downloadQueue = replaced
+	publishQueueEvent(EventQueueReordered, DownloadItem{})
+	return nil
+}
+
+// PauseAndSnapshot pauses dispatch and returns a deep copy of the queue along
+// with a function that ends the editing window. While it is open the caller
+// can build a new order from the snapshot and apply it with ReplaceQueue
+// without new downloads starting underneath. Holding the snapshot does not
+// lock the queue, so reads and in-flight downloads carry on. resume only
+// lifts the pause this call made, and leaves the queue paused if the schedule
+// window closed or the SetAutoPauseAfter batch filled up in the meantime. It
+// is safe to call more than once.
+func PauseAndSnapshot() (snapshot []DownloadItem, resume func()) {
+	pausedHere := pauseQueue()
+
+	downloadQueueLock.RLock()
+	snapshot = make([]DownloadItem, len(downloadQueue))
+	for i, item := range downloadQueue {
+		snapshot[i] = deepCopyItem(item)
+	}
+	downloadQueueLock.RUnlock()
+
+	var once sync.Once
+	resume = func() {
+		once.Do(func() {
+			if !pausedHere || remainingUntilPause() == 0 || holdForSchedule() {
+				return
+			}
+			unpauseQueue()
+		})
+	}
+	return snapshot, resume
+}
+
+func deepCopyItem(item DownloadItem) DownloadItem {
+	if item.StateHistory != nil {
+		item.StateHistory = append([]StateTransition(nil), item.StateHistory...)
+	}
+	return item
+}
@@ -0,0 +1,297 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const queueFileVersion = 1
+
+var binaryQueueMagic = []byte("SFQB")
+
+type PersistFormat string
+
+const (
+	PersistJSON   PersistFormat = "json"
+	PersistBinary PersistFormat = "binary"
+)
+
+type persistedQueue struct {
+	Version          int               `json:"version"`
+	SavedAt          int64             `json:"saved_at"`
+	TotalDownloaded  float64           `json:"total_downloaded"`
+	SessionStartTime int64             `json:"session_start_time"`
+	LifetimeTotal    int64             `json:"lifetime_total"`
+	SessionMeta      map[string]string `json:"session_meta,omitempty"`
+	Items            []DownloadItem    `json:"items"`
+}
+
+type queueMigration func(data []byte) ([]byte, error)
+
+var queueMigrations = map[int]queueMigration{
+	0: migrateQueueV0,
+}
+
+func migrateQueueV0(data []byte) ([]byte, error) {
+	var items []DownloadItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to parse legacy queue: %w", err)
+	}
+	for i := range items {
+		if items[i].Status == "" {
+			items[i].Status = StatusQueued
+		}
+	}
+	return json.Marshal(persistedQueue{
+		Version: 1,
+		Items:   items,
+	})
+}
+
+func SaveQueueToFile(path string) error {
+	return SaveQueueToFileFormat(path, PersistJSON)
+}
+
+// SaveQueueToFileFormat writes the queue as indented JSON or as a gob-encoded
+// binary file behind a magic header, which is smaller and faster to load for
+// large queues. LoadQueueFromFile detects the format automatically.
+func SaveQueueToFileFormat(path string, format PersistFormat) error {
+	downloadQueueLock.RLock()
+	items := make([]DownloadItem, len(downloadQueue))
+	copy(items, downloadQueue)
+	downloadQueueLock.RUnlock()
+
+	totalDownloadedLock.RLock()
+	total := totalDownloaded
+	totalDownloadedLock.RUnlock()
+
+	sessionStartLock.RLock()
+	sessionStart := sessionStartTime
+	sessionStartLock.RUnlock()
+
+	saved := persistedQueue{
+		Version:          queueFileVersion,
+		SavedAt:          time.Now().Unix(),
+		TotalDownloaded:  total,
+		SessionStartTime: sessionStart,
+		LifetimeTotal:    GetLifetimeTotal(),
+		SessionMeta:      GetSessionMeta(),
+		Items:            items,
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case PersistJSON, "":
+		data, err = json.MarshalIndent(saved, "", "  ")
+	case PersistBinary:
+		data, err = encodeBinaryQueue(saved)
+	default:
+		return fmt.Errorf("unsupported queue file format: %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode queue: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	return nil
+}
+
+func LoadQueueFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read queue file: %w", err)
+	}
+
+	saved, err := decodePersistedQueue(data)
+	if err != nil {
+		return err
+	}
+
+	downloadQueueLock.Lock()
+	downloadQueue = saved.Items
+	if downloadQueue == nil {
+		downloadQueue = []DownloadItem{}
+	}
+	lastClear = nil
+	total, bySource := completedTotalsLocked()
+	downloadQueueLock.Unlock()
+
+	// Older files do not carry a total, and a saved one can also cover items
+	// cleared before saving, so keep whichever is larger.
+	if saved.TotalDownloaded > total {
+		total = saved.TotalDownloaded
+	}
+	totalDownloadedLock.Lock()
+	totalDownloaded = total
+	totalDownloadedLock.Unlock()
+
+	bandwidthBySourceLock.Lock()
+	bandwidthBySource = bySource
+	bandwidthBySourceLock.Unlock()
+
+	sessionStartLock.Lock()
+	sessionStartTime = saved.SessionStartTime
+	sessionStartLock.Unlock()
+
+	raiseLifetimeTotal(saved.LifetimeTotal)
+	replaceSessionMeta(saved.SessionMeta)
+
+	return nil
+}
+
+func encodeBinaryQueue(saved persistedQueue) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(binaryQueueMagic)
+	if err := gob.NewEncoder(&buf).Encode(saved); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBinaryQueue(data []byte) (persistedQueue, error) {
+	var saved persistedQueue
+	if err := gob.NewDecoder(bytes.NewReader(data[len(binaryQueueMagic):])).Decode(&saved); err != nil {
+		return persistedQueue{}, fmt.Errorf("failed to parse binary queue file: %w", err)
+	}
+	if saved.Version > queueFileVersion {
+		return persistedQueue{}, fmt.Errorf("queue file version %d is newer than supported version %d", saved.Version, queueFileVersion)
+	}
+	return saved, nil
+}
+
+func decodePersistedQueue(data []byte) (persistedQueue, error) {
+	if bytes.HasPrefix(data, binaryQueueMagic) {
+		return decodeBinaryQueue(data)
+	}
+
+	version := 0
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var header struct {
+			Version int `json:"version"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return persistedQueue{}, fmt.Errorf("failed to parse queue file: %w", err)
+		}
+		version = header.Version
+	}
+
+	if version > queueFileVersion {
+		return persistedQueue{}, fmt.Errorf("queue file version %d is newer than supported version %d", version, queueFileVersion)
+	}
+
+	for version < queueFileVersion {
+		migrate, ok := queueMigrations[version]
+		if !ok {
+			return persistedQueue{}, fmt.Errorf("no migration available for queue file version %d", version)
+		}
+
+		migrated, err := migrate(data)
+		if err != nil {
+			return persistedQueue{}, fmt.Errorf("failed to migrate queue file from version %d: %w", version, err)
+		}
+		data = migrated
+		version++
+	}
+
+	var saved persistedQueue
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return persistedQueue{}, fmt.Errorf("failed to parse queue file: %w", err)
+	}
+	return saved, nil
+}
+
+type MergeResult struct {
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"`
+	Merged  int `json:"merged"`
+}
+
+func MergeQueue(items []DownloadItem, policy DuplicatePolicy) MergeResult {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	var result MergeResult
+	var completedSize float64
+
+	for _, incoming := range items {
+		if !isTerminalStatus(incoming.Status) {
+			incoming.Status = StatusQueued
+			incoming.StartTime = 0
+			incoming.StartedAtMillis = 0
+			incoming.EndTime = 0
+			incoming.Progress = 0
+			incoming.Speed = 0
+			if incoming.QueuedAt == 0 {
+				incoming.QueuedAt = getCurrentTimeMillis()
+			}
+		}
+
+		if index := indexOfItemLocked(incoming.ID); index >= 0 {
+			existing := downloadQueue[index]
+			if existing.Status == StatusQueued && isTerminalStatus(incoming.Status) {
+				downloadQueue[index] = incoming
+				publishQueueEvent(EventItemUpdated, incoming)
+				if incoming.Status == StatusCompleted {
+					completedSize += incoming.TotalSize
+				}
+				result.Merged++
+			} else {
+				result.Skipped++
+			}
+			continue
+		}
+
+		if isDuplicateLocked(incoming.SpotifyID, policy) {
+			result.Skipped++
+			continue
+		}
+
+		downloadQueue = append(downloadQueue, incoming)
+		publishQueueEvent(EventItemAdded, incoming)
+		if incoming.Status == StatusCompleted {
+			completedSize += incoming.TotalSize
+		}
+		result.Added++
+	}
+
+	if completedSize > 0 {
+		totalDownloadedLock.Lock()
+		totalDownloaded += completedSize
+		totalDownloadedLock.Unlock()
+	}
+	if result.Added > 0 {
+		startSessionIfNeeded()
+	}
+	evictHistoryLocked()
+
+	return result
+}
+
+// GetQueueItem returns a copy of the item with the given ID, or false when it
+// is not in the queue.
+func GetQueueItem(id string) (DownloadItem, bool) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	index := indexOfItemLocked(id)
+	if index < 0 {
+		return DownloadItem{}, false
+	}
+	return downloadQueue[index], true
+}
+
+func indexOfItemLocked(id string) int {
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
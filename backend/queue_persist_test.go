@@ -0,0 +1,185 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func queueSnapshot() []DownloadItem {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+	return append([]DownloadItem(nil), downloadQueue...)
+}
+
+func TestQueueFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		format PersistFormat
+	}{
+		{name: "json", format: PersistJSON},
+		{name: "binary", format: PersistBinary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			startItem(t, "completed")
+			CompleteDownloadItem("completed", "/music/completed.flac", 12.5)
+			startItem(t, "failed")
+			FailDownloadItem("failed", "HTTP 404")
+			if err := AddToQueueFull(QueueRequest{ID: "queued", TrackName: "Queued", SourceURL: "https://example.com/a", ExpectedSize: 1 << 20}); err != nil {
+				t.Fatal(err)
+			}
+
+			want := queueSnapshot()
+			wantTotal := sessionTotal()
+			path := filepath.Join(t.TempDir(), "queue."+tt.name)
+			if err := SaveQueueToFileFormat(path, tt.format); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			ClearAllDownloads()
+			if err := LoadQueueFromFile(path); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if got := queueSnapshot(); !reflect.DeepEqual(got, want) {
+				t.Errorf("loaded queue differs\ngot  %+v\nwant %+v", got, want)
+			}
+			if got := sessionTotal(); got != wantTotal {
+				t.Errorf("total downloaded = %v, want %v", got, wantTotal)
+			}
+		})
+	}
+}
+
+// mixedHistory is a restored queue with 15 MB downloaded from two sources,
+// 3 MB imported by hand and one item of each other status.
+var mixedHistory = []DownloadItem{
+	{ID: "tidal", Status: StatusCompleted, Source: "tidal", TotalSize: 10},
+	{ID: "qobuz", Status: StatusCompleted, Source: "qobuz", TotalSize: 5},
+	{ID: "imported", Status: StatusCompleted, TotalSize: 3, Imported: true},
+	{ID: "failed", Status: StatusFailed},
+	{ID: "skipped", Status: StatusSkipped},
+	{ID: "queued", Status: StatusQueued},
+}
+
+func writeQueueFile(t *testing.T, saved persistedQueue) string {
+	t.Helper()
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "queue.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadQueueRecomputesSessionStats(t *testing.T) {
+	tests := []struct {
+		name         string
+		savedTotal   float64
+		countImports bool
+		wantTotal    float64
+	}{
+		{name: "file without a total", wantTotal: 15},
+		{name: "imports counted", countImports: true, wantTotal: 18},
+		{name: "saved total covers cleared items", savedTotal: 40, wantTotal: 40},
+		{name: "stale saved total", savedTotal: 4, wantTotal: 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			SetImportsCountTowardTotal(tt.countImports)
+			t.Cleanup(func() { SetImportsCountTowardTotal(false) })
+
+			path := writeQueueFile(t, persistedQueue{
+				Version:         queueFileVersion,
+				TotalDownloaded: tt.savedTotal,
+				Items:           mixedHistory,
+			})
+			if err := LoadQueueFromFile(path); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := GetSessionStats()
+			if stats.TotalDownloaded != tt.wantTotal {
+				t.Errorf("total downloaded = %v, want %v", stats.TotalDownloaded, tt.wantTotal)
+			}
+			counts := [4]int{stats.CompletedCount, stats.FailedCount, stats.SkippedCount, stats.QueuedCount}
+			if want := [4]int{3, 1, 1, 1}; counts != want {
+				t.Errorf("completed, failed, skipped, queued = %v, want %v", counts, want)
+			}
+			wantSources := map[string]int64{"tidal": 10 * bytesPerMiB, "qobuz": 5 * bytesPerMiB}
+			if got := GetBandwidthBySource(); !reflect.DeepEqual(got, wantSources) {
+				t.Errorf("bandwidth by source = %v, want %v", got, wantSources)
+			}
+		})
+	}
+}
+
+func TestLoadQueueKeepsLargerLifetimeTotal(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int64
+		saved   int64
+		want    int64
+	}{
+		{name: "newer file raises the total", current: 10, saved: 40, want: 40},
+		{name: "older file keeps the total", current: 40, saved: 10, want: 40},
+		{name: "file without a total", current: 40, want: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			lifetimeDownloaded.Store(tt.current)
+			t.Cleanup(ResetLifetimeTotal)
+
+			path := writeQueueFile(t, persistedQueue{
+				Version:       queueFileVersion,
+				LifetimeTotal: tt.saved,
+				Items:         mixedHistory,
+			})
+			if err := LoadQueueFromFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if got := GetLifetimeTotal(); got != tt.want {
+				t.Errorf("lifetime total = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveQueueUnknownFormat(t *testing.T) {
+	resetQueueState(t)
+	path := filepath.Join(t.TempDir(), "queue")
+	if err := SaveQueueToFileFormat(path, "xml"); err == nil {
+		t.Error("saving as xml succeeded")
+	}
+}
+
+func BenchmarkLoadQueueFromFile(b *testing.B) {
+	for _, format := range []PersistFormat{PersistJSON, PersistBinary} {
+		b.Run(string(format), func(b *testing.B) {
+			fillQueue(b, 5000)
+			path := filepath.Join(b.TempDir(), fmt.Sprintf("queue.%s", format))
+			if err := SaveQueueToFileFormat(path, format); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if err := LoadQueueFromFile(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
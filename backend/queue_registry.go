@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	activeWorkers     = make(map[string]int64)
+	activeWorkersLock sync.RWMutex
+
+	countedDownloads     = make(map[string]bool)
+	countedDownloadsLock sync.Mutex
+)
+
+func claimDownload(id string) {
+	activeWorkersLock.Lock()
+	activeWorkers[id] = getCurrentTimeMillis()
+	activeWorkersLock.Unlock()
+}
+
+func ReleaseDownloadItem(id string) {
+	activeWorkersLock.Lock()
+	delete(activeWorkers, id)
+	activeWorkersLock.Unlock()
+	triggerAutoStart()
+}
+
+func hasActiveWorker(id string) bool {
+	activeWorkersLock.RLock()
+	_, ok := activeWorkers[id]
+	activeWorkersLock.RUnlock()
+	return ok
+}
+
+// SetItemDownloading is SetDownloading for a transfer that belongs to a queue
+// item. Which items the activeDownloads counter includes is recorded, so a
+// repeated call for the same item has no effect and the share of items that
+// stopped downloading without saying so can be found and taken back.
+func SetItemDownloading(id string, downloading bool) {
+	countedDownloadsLock.Lock()
+	if countedDownloads[id] == downloading {
+		countedDownloadsLock.Unlock()
+		return
+	}
+	if downloading {
+		countedDownloads[id] = true
+	} else {
+		delete(countedDownloads, id)
+	}
+	countedDownloadsLock.Unlock()
+
+	SetDownloading(downloading)
+}
+
+func countedDownloadIDs() []string {
+	countedDownloadsLock.Lock()
+	defer countedDownloadsLock.Unlock()
+
+	ids := make([]string, 0, len(countedDownloads))
+	for id := range countedDownloads {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func activeWorkerIDs() []string {
+	activeWorkersLock.RLock()
+	defer activeWorkersLock.RUnlock()
+
+	ids := make([]string, 0, len(activeWorkers))
+	for id := range activeWorkers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+type OrphanAction string
+
+const (
+	OrphanRequeue OrphanAction = "requeue"
+	OrphanFail    OrphanAction = "fail"
+)
+
+var (
+	orphanAction     = OrphanRequeue
+	orphanActionLock sync.RWMutex
+)
+
+func SetOrphanAction(action OrphanAction) {
+	orphanActionLock.Lock()
+	orphanAction = action
+	orphanActionLock.Unlock()
+}
+
+func ReconcileState() int {
+	orphanActionLock.RLock()
+	action := orphanAction
+	orphanActionLock.RUnlock()
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	fixed := 0
+	for i := range downloadQueue {
+		item := &downloadQueue[i]
+		if item.Status != StatusDownloading || hasActiveWorker(item.ID) {
+			continue
+		}
+
+		if action == OrphanFail {
+			item.Status = StatusFailed
+			item.EndTime = time.Now().Unix()
+			item.ErrorMessage = "Download interrupted"
+			publishQueueEvent(EventItemFailed, *item)
+		} else {
+			item.Status = StatusQueued
+			item.StartTime = 0
+			item.StartedAtMillis = 0
+			item.Progress = 0
+			item.Speed = 0
+			publishQueueEvent(EventItemRequeued, *item)
+		}
+		fmt.Printf("[Reconcile] Recovered orphaned download %s (%s - %s): %s\n", item.ID, item.TrackName, item.ArtistName, action)
+		fixed++
+	}
+
+	// Transfers outside the queue are counted too, so only the shares of
+	// items that are no longer downloading are taken back.
+	if released := releaseStaleDownloadCountsLocked(); len(released) > 0 {
+		fmt.Printf("[Reconcile] Released active download count of %d items that are not downloading: %v\n", len(released), released)
+	}
+
+	if fixed > 0 {
+		evictHistoryLocked()
+		triggerAutoStart()
+	}
+	return fixed
+}
+
+func releaseStaleDownloadCountsLocked() []string {
+	countedDownloadsLock.Lock()
+	var released []string
+	for id := range countedDownloads {
+		if index := indexOfItemLocked(id); index < 0 || downloadQueue[index].Status != StatusDownloading {
+			delete(countedDownloads, id)
+			released = append(released, id)
+		}
+	}
+	countedDownloadsLock.Unlock()
+
+	for range released {
+		SetDownloading(false)
+	}
+	return released
+}
+
+func StartPeriodicReconcile(interval time.Duration) func() {
+	stop := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ReconcileState()
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
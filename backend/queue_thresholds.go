@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	thresholdDebounce      = 500 * time.Millisecond
+	thresholdCheckInterval = 250 * time.Millisecond
+)
+
+type queueThreshold struct {
+	count        int
+	callback     func(current int)
+	above        bool
+	pending      bool
+	pendingSince time.Time
+}
+
+var (
+	queueThresholds     = make(map[int]*queueThreshold)
+	queueThresholdsLock sync.Mutex
+	nextThresholdID     int
+	thresholdWatcherRun sync.Once
+)
+
+// OnQueueThreshold calls callback whenever the number of queued items moves
+// above count or falls back to count or below. A crossing must hold for
+// thresholdDebounce before it is reported. The returned function unregisters
+// the callback.
+func OnQueueThreshold(count int, callback func(current int)) func() {
+	current := queuedCount()
+
+	queueThresholdsLock.Lock()
+	id := nextThresholdID
+	nextThresholdID++
+	queueThresholds[id] = &queueThreshold{
+		count:    count,
+		callback: callback,
+		above:    current > count,
+	}
+	queueThresholdsLock.Unlock()
+
+	thresholdWatcherRun.Do(func() {
+		go watchQueueThresholds()
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			queueThresholdsLock.Lock()
+			delete(queueThresholds, id)
+			queueThresholdsLock.Unlock()
+		})
+	}
+}
+
+func watchQueueThresholds() {
+	events, _ := SubscribeQueueEvents()
+	ticker := time.NewTicker(thresholdCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-events:
+		case <-ticker.C:
+		}
+		checkQueueThresholds(queuedCount(), time.Now())
+	}
+}
+
+func checkQueueThresholds(current int, now time.Time) {
+	queueThresholdsLock.Lock()
+	var fire []func(int)
+	for _, threshold := range queueThresholds {
+		above := current > threshold.count
+		if above == threshold.above {
+			threshold.pending = false
+			continue
+		}
+		if !threshold.pending {
+			threshold.pending = true
+			threshold.pendingSince = now
+			continue
+		}
+		if now.Sub(threshold.pendingSince) >= thresholdDebounce {
+			threshold.above = above
+			threshold.pending = false
+			fire = append(fire, threshold.callback)
+		}
+	}
+	queueThresholdsLock.Unlock()
+
+	for _, callback := range fire {
+		callback(current)
+	}
+}
+
+func queuedCount() int {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	count := 0
+	for _, item := range downloadQueue {
+		if item.Status == StatusQueued {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	minTTLSweepInterval = time.Second
+	maxTTLSweepInterval = time.Minute
+)
+
+var (
+	queueTTL        time.Duration
+	queueTTLSweeper func()
+	queueTTLLock    sync.Mutex
+)
+
+// SetQueueTTL expires items that are still queued d after they were added by
+// marking them skipped. A background sweeper runs while a TTL is set; a TTL
+// of 0 disables expiry and stops the sweeper.
+func SetQueueTTL(d time.Duration) {
+	queueTTLLock.Lock()
+	defer queueTTLLock.Unlock()
+
+	if d < 0 {
+		d = 0
+	}
+	queueTTL = d
+
+	if queueTTLSweeper != nil {
+		queueTTLSweeper()
+		queueTTLSweeper = nil
+	}
+	if d == 0 {
+		return
+	}
+
+	interval := d / 4
+	if interval < minTTLSweepInterval {
+		interval = minTTLSweepInterval
+	}
+	if interval > maxTTLSweepInterval {
+		interval = maxTTLSweepInterval
+	}
+	queueTTLSweeper = startTTLSweeper(interval)
+}
+
+func startTTLSweeper(interval time.Duration) func() {
+	stop := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ExpireQueuedItems()
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+func ExpireQueuedItems() int {
+	queueTTLLock.Lock()
+	ttl := queueTTL
+	queueTTLLock.Unlock()
+
+	if ttl == 0 {
+		return 0
+	}
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	cutoff := getCurrentTimeMillis() - ttl.Milliseconds()
+	expired := 0
+	for i := range downloadQueue {
+		item := downloadQueue[i]
+		if item.Status != StatusQueued || item.QueuedAt == 0 || item.QueuedAt > cutoff {
+			continue
+		}
+		if skipDownloadItemLocked(item.ID, "", "Queue timeout") {
+			fmt.Printf("Queue timeout: %s - %s\n", item.TrackName, item.ArtistName)
+			expired++
+		}
+	}
+
+	if expired > 0 {
+		evictHistoryLocked()
+	}
+	return expired
+}
@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const minExistingFileSize = 100 * 1024
+
+type SourceResolver func(item DownloadItem) (url string, expectedSize int64, err error)
+
+var (
+	sourceResolver     SourceResolver
+	sourceResolverLock sync.RWMutex
+
+	// preResolvedItems holds the items queued with a SourceURL that no
+	// attempt has used yet. It is guarded by downloadQueueLock.
+	preResolvedItems = make(map[string]bool)
+)
+
+func SetSourceResolver(resolver func(item DownloadItem) (url string, expectedSize int64, err error)) {
+	sourceResolverLock.Lock()
+	sourceResolver = resolver
+	sourceResolverLock.Unlock()
+}
+
+func resolveItemSource(item DownloadItem) error {
+	sourceResolverLock.RLock()
+	resolver := sourceResolver
+	sourceResolverLock.RUnlock()
+
+	downloadQueueLock.Lock()
+	preResolved := preResolvedItems[item.ID]
+	delete(preResolvedItems, item.ID)
+	downloadQueueLock.Unlock()
+
+	if resolver == nil || preResolved {
+		return skipDuplicateContent(item.ID)
+	}
+
+	resolveStart := getCurrentTimeMillis()
+	url, expectedSize, err := resolver(item)
+	resolveMillis := getCurrentTimeMillis() - resolveStart
+	SetItemResolveMillis(item.ID, resolveMillis)
+	if err != nil {
+		FailDownloadItemErr(item.ID, fmt.Errorf("Failed to resolve source: %w", err))
+		return fmt.Errorf("failed to resolve source: %w", err)
+	}
+
+	downloadQueueLock.Lock()
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == item.ID {
+			downloadQueue[i].SourceURL = url
+			if expectedSize > 0 {
+				downloadQueue[i].ExpectedSize = expectedSize
+			}
+			break
+		}
+	}
+	downloadQueueLock.Unlock()
+
+	return skipDuplicateContent(item.ID)
+}
+
+// setItemContentLength records the size the server reported for the current
+// attempt. It is kept apart from ExpectedSize so an error page cannot become
+// its own reference when CompleteDownloadItem checks the file size.
+func setItemContentLength(id string, bytes int64) {
+	updateItemTiming(id, func(item *DownloadItem) { item.ContentLength = bytes })
+}
+
+func getItemContentLength(id string) int64 {
+	if id == "" {
+		return 0
+	}
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	if index := indexOfItemLocked(id); index >= 0 {
+		return downloadQueue[index].ContentLength
+	}
+	return 0
+}
+
+// knownItemSize is the item's expected size, or the size its server reported
+// when none was given. It is only used for display and estimates.
+func knownItemSize(item DownloadItem) int64 {
+	if item.ExpectedSize > 0 {
+		return item.ExpectedSize
+	}
+	return item.ContentLength
+}
+
+func SetItemExpectedSize(id string, bytes int64) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].ExpectedSize = bytes
+			return
+		}
+	}
+}
+
+const estimateConcurrency = 4
+
+func EstimateQueueSize(resolver func(item DownloadItem) (int64, error)) (total int64, unknown int, err error) {
+	if resolver == nil {
+		return 0, 0, fmt.Errorf("size resolver is required")
+	}
+
+	downloadQueueLock.RLock()
+	var pending []DownloadItem
+	for _, item := range downloadQueue {
+		if item.Status != StatusQueued {
+			continue
+		}
+		if item.ExpectedSize > 0 {
+			total += item.ExpectedSize
+			continue
+		}
+		pending = append(pending, item)
+	}
+	downloadQueueLock.RUnlock()
+
+	sizes := make([]int64, len(pending))
+	sem := make(chan struct{}, estimateConcurrency)
+	var wg sync.WaitGroup
+
+	for i, item := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item DownloadItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			size, err := resolver(item)
+			if err != nil {
+				fmt.Printf("Failed to estimate size for %s - %s: %v\n", item.TrackName, item.ArtistName, err)
+				return
+			}
+			sizes[i] = size
+		}(i, item)
+	}
+	wg.Wait()
+
+	for i, item := range pending {
+		if sizes[i] <= 0 {
+			unknown++
+			continue
+		}
+		total += sizes[i]
+		SetItemExpectedSize(item.ID, sizes[i])
+	}
+
+	return total, unknown, nil
+}
+
+// ExistingFileComplete reports whether the file at path can stand in for the
+// item's download. When the item's expected size is known the file must be at
+// least that large, so a partial file left by an earlier run is not mistaken
+// for a finished one; otherwise any file over 100 KiB qualifies.
+func ExistingFileComplete(itemID, path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if expected := getItemExpectedSize(itemID); expected > 0 {
+		return info.Size() >= expected
+	}
+	return info.Size() > minExistingFileSize
+}
+
+func getItemExpectedSize(id string) int64 {
+	if id == "" {
+		return 0
+	}
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	for _, item := range downloadQueue {
+		if item.ID == id {
+			return item.ExpectedSize
+		}
+	}
+	return 0
+}
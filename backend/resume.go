@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const resumeVerifyBytes = 4096
+
+var (
+	resumePartialDownloads     atomic.Bool
+	resumeVerificationDisabled atomic.Bool
+)
+
+// SetResumePartialDownloads continues an existing partial file at the target
+// path with a Range request instead of downloading it again. Off by default.
+func SetResumePartialDownloads(enabled bool) {
+	resumePartialDownloads.Store(enabled)
+}
+
+// SetResumeVerification re-fetches the last few kilobytes of a partial file
+// when resuming and compares them with the server's bytes. On a mismatch the
+// download restarts from scratch. On by default. A partial file that already
+// has the full size is always checked before it is accepted.
+func SetResumeVerification(enabled bool) {
+	resumeVerificationDisabled.Store(!enabled)
+}
+
+// resumeDownload reports handled=false when there is nothing to resume or the
+// server cannot continue it, so the caller falls back to a full download.
+func resumeDownload(client *http.Client, url, path, itemID string, prepare func(*http.Request)) (bool, error) {
+	if !resumePartialDownloads.Load() {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return false, nil
+	}
+	offset := info.Size()
+
+	// The request always starts a little before the end of the local file so
+	// the overlap can be compared, but it is only checked when verification is
+	// on or the file already looks complete.
+	overlap := int64(resumeVerifyBytes)
+	if offset < overlap {
+		overlap = offset
+	}
+	verify := !resumeVerificationDisabled.Load() && offset >= resumeVerifyBytes
+	start := offset - overlap
+
+	req, err := newItemDownloadRequest(itemID, "GET", url, nil)
+	if err != nil {
+		return false, nil
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, nil
+	}
+	defer resp.Body.Close()
+
+	total, ok := parseContentRange(resp, start)
+	if !ok {
+		return false, nil
+	}
+	if total < offset {
+		fmt.Printf("Partial file is larger than the remote file, restarting: %s\n", path)
+		os.Remove(path)
+		return false, nil
+	}
+
+	out, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return true, transferError(itemID, fmt.Errorf("failed to open partial file: %w", err), 0)
+	}
+	defer out.Close()
+
+	// A file at full size is not trusted as is: a failed segmented download
+	// allocates the whole file before writing it.
+	complete := total == offset
+	if verify || complete {
+		matched, err := verifyResumeOverlap(out, resp.Body, start, overlap)
+		if err != nil {
+			return true, transferError(itemID, fmt.Errorf("failed to verify partial file: %w", err), 0)
+		}
+		if !matched {
+			fmt.Printf("Partial file does not match the remote content, restarting: %s\n", path)
+			out.Close()
+			os.Remove(path)
+			return false, nil
+		}
+		if complete {
+			fmt.Printf("Partial file is already complete: %s\n", path)
+			return true, nil
+		}
+	} else if _, err := io.CopyN(io.Discard, resp.Body, overlap); err != nil {
+		return true, transferError(itemID, fmt.Errorf("failed to read response: %w", err), 0)
+	}
+
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return true, transferError(itemID, fmt.Errorf("failed to seek partial file: %w", err), 0)
+	}
+
+	fmt.Printf("Resuming download at %.2f MB of %.2f MB\n", float64(offset)/(1024*1024), float64(total)/(1024*1024))
+
+	pw := NewProgressWriterWithID(out, itemID)
+	pw.SetExpectedSize(total)
+	pw.total = offset
+	pw.lastPrinted = offset
+	pw.lastBytes = offset
+
+	_, err = io.Copy(pw, resp.Body)
+	if finishErr := pw.Finish(); err == nil {
+		err = finishErr
+	}
+	if err != nil {
+		return true, transferError(itemID, fmt.Errorf("failed to write file: %w", err), pw.GetTotal()-offset)
+	}
+
+	fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
+	return true, nil
+}
+
+func parseContentRange(resp *http.Response, start int64) (int64, bool) {
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, false
+	}
+
+	contentRange := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	dash := strings.Index(contentRange, "-")
+	slash := strings.LastIndex(contentRange, "/")
+	if dash < 0 || slash < dash {
+		return 0, false
+	}
+
+	rangeStart, err := strconv.ParseInt(contentRange[:dash], 10, 64)
+	if err != nil || rangeStart != start {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil || total <= 0 {
+		return 0, false
+	}
+	return total, true
+}
+
+func verifyResumeOverlap(local io.ReaderAt, remote io.Reader, start, n int64) (bool, error) {
+	localTail := make([]byte, n)
+	if _, err := local.ReadAt(localTail, start); err != nil {
+		return false, err
+	}
+
+	remoteHead := make([]byte, n)
+	if _, err := io.ReadFull(remote, remoteHead); err != nil {
+		return false, err
+	}
+	return bytes.Equal(localTail, remoteHead), nil
+}
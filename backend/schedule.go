@@ -0,0 +1,241 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const scheduleCheckInterval = 30 * time.Second
+
+// TimeWindow is a daily period in local time during which downloads may run.
+// Start and End are times of day written as durations, so 1h30m is 01:30 on
+// the clock even on days when daylight saving time changes. A window whose
+// End is before its Start runs past midnight, and one whose Start equals its
+// End covers the whole day.
+type TimeWindow struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+}
+
+func (w TimeWindow) contains(now time.Time) bool {
+	if w.Start == w.End {
+		return true
+	}
+	start, end := clockTime(now, w.Start), clockTime(now, w.End)
+	if w.Start < w.End {
+		return !now.Before(start) && now.Before(end)
+	}
+	return !now.Before(start) || now.Before(end)
+}
+
+// clockTime returns the instant on now's day when the local clock reads
+// timeOfDay.
+func clockTime(now time.Time, timeOfDay time.Duration) time.Time {
+	hour := int(timeOfDay / time.Hour)
+	minute := int(timeOfDay % time.Hour / time.Minute)
+	second := int(timeOfDay % time.Minute / time.Second)
+	return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, second, 0, now.Location())
+}
+
+var (
+	scheduleWindows []TimeWindow
+	scheduleStop    chan struct{}
+	scheduleLock    sync.Mutex
+
+	schedulePaused       atomic.Bool
+	schedulePausesActive atomic.Bool
+
+	scheduleInterrupted     = make(map[string]bool)
+	scheduleInterruptedLock sync.Mutex
+)
+
+// SetSchedule limits downloading to windows. The queue is paused when the
+// last open window closes and resumed when the next one opens; the schedule
+// is checked every 30 seconds. A queue that was already paused by hand when
+// a window closes is left alone, and resuming by hand outside a window is
+// kept until the next window opens and closes. An empty schedule removes the
+// limit and lifts a pause the schedule made.
+func SetSchedule(windows []TimeWindow) error {
+	if err := validateSchedule(windows); err != nil {
+		return err
+	}
+	windows = append([]TimeWindow(nil), windows...)
+
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	if scheduleStop != nil {
+		close(scheduleStop)
+		scheduleStop = nil
+	}
+	scheduleWindows = windows
+	if len(windows) == 0 {
+		if schedulePaused.Load() {
+			ResumeQueue()
+		}
+		return nil
+	}
+
+	open := scheduleOpen(windows, time.Now())
+	applyScheduleLocked(open)
+
+	stop := make(chan struct{})
+	scheduleStop = stop
+	go runSchedule(windows, stop, open)
+	return nil
+}
+
+func validateSchedule(windows []TimeWindow) error {
+	for _, w := range windows {
+		if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End > 24*time.Hour {
+			return fmt.Errorf("time window %s-%s is outside the day", w.Start, w.End)
+		}
+	}
+	return nil
+}
+
+// GetSchedule returns the windows set with SetSchedule.
+func GetSchedule() []TimeWindow {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	return append([]TimeWindow(nil), scheduleWindows...)
+}
+
+// SetSchedulePausesActive decides what happens to downloads in progress when
+// a window closes. By default they are allowed to finish. When enabled they
+// are interrupted and put back in the queue; with SetResumePartialDownloads
+// they continue from their partial file once the next window opens.
+func SetSchedulePausesActive(enabled bool) {
+	schedulePausesActive.Store(enabled)
+}
+
+// IsSchedulePaused reports whether the queue is paused because it is outside
+// the download schedule rather than by PauseQueue.
+func IsSchedulePaused() bool {
+	return schedulePaused.Load() && queuePaused.Load()
+}
+
+func runSchedule(windows []TimeWindow, stop chan struct{}, open bool) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			nowOpen := scheduleOpen(windows, now)
+			if nowOpen == open {
+				continue
+			}
+			open = nowOpen
+
+			scheduleLock.Lock()
+			if scheduleStop == stop {
+				applyScheduleLocked(open)
+			}
+			scheduleLock.Unlock()
+		}
+	}
+}
+
+// holdForSchedule reports whether the queue should stay paused because the
+// schedule is closed, recording the pause as the schedule's so the next
+// window resumes it. It is used when a pause made for another reason ends.
+func holdForSchedule() bool {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	if len(scheduleWindows) == 0 || scheduleOpen(scheduleWindows, time.Now()) {
+		return false
+	}
+	schedulePaused.Store(true)
+	return true
+}
+
+func scheduleOpen(windows []TimeWindow, now time.Time) bool {
+	for _, w := range windows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyScheduleLocked(open bool) {
+	if open {
+		if schedulePaused.Load() {
+			fmt.Println("[Schedule] Download window opened, resuming queue")
+			ResumeQueue()
+		}
+		return
+	}
+	if queuePaused.Load() {
+		return
+	}
+
+	fmt.Println("[Schedule] Download window closed, pausing queue")
+	schedulePaused.Store(true)
+	PauseQueue()
+	if schedulePausesActive.Load() {
+		if interrupted := interruptActiveDownloads(); interrupted > 0 {
+			fmt.Printf("[Schedule] Interrupted %d active downloads\n", interrupted)
+		}
+	}
+}
+
+// interruptActiveDownloads cancels every download in progress. Their failure
+// is turned back into a requeue by failDownloadItemLocked.
+func interruptActiveDownloads() int {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	interrupted := 0
+	for _, item := range downloadQueue {
+		if item.Status != StatusDownloading {
+			continue
+		}
+		scheduleInterruptedLock.Lock()
+		scheduleInterrupted[item.ID] = true
+		scheduleInterruptedLock.Unlock()
+		cancelItemAttempt(item.ID, ErrCancelled)
+		interrupted++
+	}
+	return interrupted
+}
+
+// requeueIfInterruptedLocked puts an item whose download was stopped by the
+// schedule back in the queue without counting a retry.
+func requeueIfInterruptedLocked(item *DownloadItem, err error) bool {
+	if !errors.Is(err, ErrCancelled) {
+		return false
+	}
+	scheduleInterruptedLock.Lock()
+	interrupted := scheduleInterrupted[item.ID]
+	delete(scheduleInterrupted, item.ID)
+	scheduleInterruptedLock.Unlock()
+	if !interrupted {
+		return false
+	}
+
+	item.Status = StatusQueued
+	item.QueuedAt = getCurrentTimeMillis()
+	item.StartTime = 0
+	item.StartedAtMillis = 0
+	item.Progress = 0
+	item.Speed = 0
+	item.ErrorMessage = ""
+	item.ErrorCode = ""
+	publishQueueEvent(EventItemRequeued, *item)
+	triggerAutoStart()
+	return true
+}
+
+func forgetScheduleInterruption(id string) {
+	scheduleInterruptedLock.Lock()
+	delete(scheduleInterrupted, id)
+	scheduleInterruptedLock.Unlock()
+}
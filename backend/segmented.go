@@ -0,0 +1,194 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const minSegmentSize = 4 * 1024 * 1024
+
+var parallelSegments atomic.Int64
+
+// SetParallelSegments downloads direct file URLs with n concurrent Range
+// requests when the server supports them. Values below 2 keep the
+// single-stream download.
+func SetParallelSegments(n int) {
+	if n < 0 {
+		n = 0
+	}
+	parallelSegments.Store(int64(n))
+}
+
+type segmentWriter struct {
+	out      *io.OffsetWriter
+	progress *ProgressWriter
+	mu       *sync.Mutex
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	diskWrites.acquire()
+	n, err := w.out.Write(p)
+	diskWrites.release()
+
+	w.mu.Lock()
+	_, progressErr := w.progress.Write(p[:n])
+	w.mu.Unlock()
+	if err == nil {
+		err = progressErr
+	}
+	return n, err
+}
+
+// downloadSegmented reports handled=false when segmented download is disabled
+// or the server does not support ranges, so the caller can fall back to a
+// single stream.
+func downloadSegmented(client *http.Client, url, path, itemID string, prepare func(*http.Request)) (bool, error) {
+	segments := int(parallelSegments.Load())
+	if segments < 2 {
+		return false, nil
+	}
+
+	total, ok := probeRangeSupport(client, url, itemID, prepare)
+	if !ok || total < int64(segments)*minSegmentSize {
+		return false, nil
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return true, transferError(itemID, fmt.Errorf("failed to create file: %w", err), 0)
+	}
+	defer out.Close()
+
+	if err := out.Truncate(total); err != nil {
+		return true, transferError(itemID, fmt.Errorf("failed to allocate file: %w", err), 0)
+	}
+
+	fmt.Printf("Downloading in %d segments (%.2f MB)\n", segments, float64(total)/(1024*1024))
+
+	pw := NewProgressWriterWithID(io.Discard, itemID)
+	pw.SetExpectedSize(total)
+	var progressLock sync.Mutex
+
+	ctx, cancel := context.WithCancel(ItemContext(itemID))
+	defer cancel()
+
+	segmentSize := total / int64(segments)
+	errs := make(chan error, segments)
+	var wg sync.WaitGroup
+	for i := 0; i < segments; i++ {
+		start := int64(i) * segmentSize
+		end := start + segmentSize - 1
+		if i == segments-1 {
+			end = total - 1
+		}
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			writer := &segmentWriter{
+				out:      io.NewOffsetWriter(out, start),
+				progress: pw,
+				mu:       &progressLock,
+			}
+			if err := fetchSegment(ctx, client, url, start, end, writer, prepare); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	close(errs)
+
+	progressLock.Lock()
+	finishErr := pw.Finish()
+	progressLock.Unlock()
+
+	// The file was allocated at full size up front, so a failed download must
+	// not leave it looking complete to a later resume.
+	if err := <-errs; err != nil {
+		out.Truncate(0)
+		return true, transferError(itemID, fmt.Errorf("failed to download segment: %w", err), pw.GetTotal())
+	}
+	if finishErr != nil {
+		out.Truncate(0)
+		return true, transferError(itemID, fmt.Errorf("failed to write file: %w", finishErr), pw.GetTotal())
+	}
+
+	fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
+	return true, nil
+}
+
+func probeRangeSupport(client *http.Client, url, itemID string, prepare func(*http.Request)) (int64, bool) {
+	req, err := newItemDownloadRequest(itemID, "GET", url, nil)
+	if err != nil {
+		return 0, false
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, false
+	}
+
+	contentRange := resp.Header.Get("Content-Range")
+	slash := strings.LastIndex(contentRange, "/")
+	if slash < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil || total <= 0 {
+		return 0, false
+	}
+	return total, true
+}
+
+func fetchSegment(ctx context.Context, client *http.Client, url string, start, end int64, w io.Writer, prepare func(*http.Request)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("segment %d-%d returned status %d", start, end, resp.StatusCode)
+	}
+
+	buf, release, err := acquireCopyBuffer(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	written, err := io.CopyBuffer(w, resp.Body, buf)
+	if err != nil {
+		return err
+	}
+	if written != end-start+1 {
+		return fmt.Errorf("segment %d-%d was truncated after %d bytes", start, end, written)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package backend
+
+import "sync"
+
+var (
+	sessionMeta     = make(map[string]string)
+	sessionMetaLock sync.RWMutex
+)
+
+// SetSessionMeta tags the current session with a key/value pair, such as a
+// playlist name or request ID. An empty value removes the key.
+func SetSessionMeta(key, value string) {
+	sessionMetaLock.Lock()
+	defer sessionMetaLock.Unlock()
+
+	if value == "" {
+		delete(sessionMeta, key)
+		return
+	}
+	sessionMeta[key] = value
+}
+
+func GetSessionMeta() map[string]string {
+	sessionMetaLock.RLock()
+	defer sessionMetaLock.RUnlock()
+
+	meta := make(map[string]string, len(sessionMeta))
+	for key, value := range sessionMeta {
+		meta[key] = value
+	}
+	return meta
+}
+
+func replaceSessionMeta(meta map[string]string) {
+	sessionMetaLock.Lock()
+	sessionMeta = make(map[string]string, len(meta))
+	for key, value := range meta {
+		sessionMeta[key] = value
+	}
+	sessionMetaLock.Unlock()
+}
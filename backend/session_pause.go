@@ -0,0 +1,61 @@
+package backend
+
+import "time"
+
+// Pause accounting is guarded by sessionStartLock alongside sessionStartTime.
+var (
+	sessionPausedMillis int64
+	sessionPausedAt     int64
+)
+
+func beginSessionPause() {
+	sessionStartLock.Lock()
+	if sessionPausedAt == 0 {
+		sessionPausedAt = getCurrentTimeMillis()
+	}
+	sessionStartLock.Unlock()
+}
+
+func endSessionPause() {
+	sessionStartLock.Lock()
+	if sessionPausedAt > 0 {
+		if sessionStartTime > 0 {
+			sessionPausedMillis += getCurrentTimeMillis() - sessionPausedAt
+		}
+		sessionPausedAt = 0
+	}
+	sessionStartLock.Unlock()
+}
+
+// resetSessionPauseLocked clears the accumulated pause time when the session
+// timer is reset. A pause in progress keeps running from now, so the next
+// session does not inherit time paused before it started.
+func resetSessionPauseLocked() {
+	sessionPausedMillis = 0
+	if sessionPausedAt > 0 {
+		sessionPausedAt = getCurrentTimeMillis()
+	}
+}
+
+func sessionPausedDurationLocked() time.Duration {
+	paused := sessionPausedMillis
+	if sessionPausedAt > 0 && sessionStartTime > 0 {
+		paused += getCurrentTimeMillis() - sessionPausedAt
+	}
+	return time.Duration(paused) * time.Millisecond
+}
+
+// sessionTimesLocked returns the session start along with the wall time since
+// then and the part of it spent paused.
+func sessionTimesLocked() (start int64, wall, paused time.Duration) {
+	start = sessionStartTime
+	if start == 0 {
+		return 0, 0, 0
+	}
+	wall = time.Since(time.Unix(start, 0))
+	paused = sessionPausedDurationLocked()
+	if paused > wall {
+		paused = wall
+	}
+	return start, wall, paused
+}
@@ -0,0 +1,136 @@
+package backend
+
+import "sync"
+
+var (
+	bandwidthBySource     = make(map[string]int64)
+	bandwidthBySourceLock sync.Mutex
+)
+
+type SessionStats struct {
+	SessionStartTime        int64            `json:"session_start_time"`
+	TotalDownloaded         float64          `json:"total_downloaded"`
+	QueuedCount             int              `json:"queued_count"`
+	DownloadingCount        int              `json:"downloading_count"`
+	CompletedCount          int              `json:"completed_count"`
+	FailedCount             int              `json:"failed_count"`
+	SkippedCount            int              `json:"skipped_count"`
+	AverageQueueWaitSeconds float64          `json:"average_queue_wait_seconds"`
+	BandwidthBySource       map[string]int64 `json:"bandwidth_by_source"`
+	PausedSeconds           float64          `json:"paused_seconds"`
+	ActiveSeconds           float64          `json:"active_seconds"`
+	AverageSpeedMBps        float64          `json:"average_speed_mbps"`
+}
+
+func GetBandwidthBySource() map[string]int64 {
+	bandwidthBySourceLock.Lock()
+	defer bandwidthBySourceLock.Unlock()
+
+	usage := make(map[string]int64, len(bandwidthBySource))
+	for source, bytes := range bandwidthBySource {
+		usage[source] = bytes
+	}
+	return usage
+}
+
+func addSourceBandwidth(source string, mb float64) {
+	if mb <= 0 {
+		return
+	}
+	bandwidthBySourceLock.Lock()
+	bandwidthBySource[source] += int64(mb * bytesPerMiB)
+	bandwidthBySourceLock.Unlock()
+}
+
+func resetSourceBandwidth() {
+	bandwidthBySourceLock.Lock()
+	bandwidthBySource = make(map[string]int64)
+	bandwidthBySourceLock.Unlock()
+}
+
+// RecomputeSessionStats rebuilds the session download total and per-source
+// bandwidth from the completed items in the queue, for example after a
+// restore. Completed items that were already cleared from the queue are no
+// longer counted. The status counts are always derived from the queue.
+func RecomputeSessionStats() {
+	downloadQueueLock.RLock()
+	total, bySource := completedTotalsLocked()
+	downloadQueueLock.RUnlock()
+
+	totalDownloadedLock.Lock()
+	totalDownloaded = total
+	totalDownloadedLock.Unlock()
+
+	bandwidthBySourceLock.Lock()
+	bandwidthBySource = bySource
+	bandwidthBySourceLock.Unlock()
+}
+
+func completedTotalsLocked() (float64, map[string]int64) {
+	countImports := importsCountTowardTotal.Load()
+	var total float64
+	bySource := make(map[string]int64)
+	for _, item := range downloadQueue {
+		if item.Status != StatusCompleted || item.TotalSize <= 0 {
+			continue
+		}
+		if item.Imported && !countImports {
+			continue
+		}
+		total += item.TotalSize
+		if !item.Imported {
+			bySource[item.Source] += int64(item.TotalSize * bytesPerMiB)
+		}
+	}
+	return total, bySource
+}
+
+func GetSessionStats() SessionStats {
+	var stats SessionStats
+
+	downloadQueueLock.RLock()
+	var waitTotal float64
+	var waitCount int
+	for _, item := range downloadQueue {
+		switch item.Status {
+		case StatusQueued:
+			stats.QueuedCount++
+		case StatusDownloading:
+			stats.DownloadingCount++
+		case StatusCompleted:
+			stats.CompletedCount++
+		case StatusFailed:
+			stats.FailedCount++
+		case StatusSkipped:
+			stats.SkippedCount++
+		}
+		if item.Status != StatusQueued && item.QueueWaitSeconds > 0 {
+			waitTotal += item.QueueWaitSeconds
+			waitCount++
+		}
+	}
+	downloadQueueLock.RUnlock()
+
+	if waitCount > 0 {
+		stats.AverageQueueWaitSeconds = waitTotal / float64(waitCount)
+	}
+
+	totalDownloadedLock.RLock()
+	stats.TotalDownloaded = totalDownloaded
+	totalDownloadedLock.RUnlock()
+
+	sessionStartLock.RLock()
+	start, wall, paused := sessionTimesLocked()
+	sessionStartLock.RUnlock()
+
+	stats.SessionStartTime = start
+	stats.PausedSeconds = paused.Seconds()
+	stats.ActiveSeconds = (wall - paused).Seconds()
+	if stats.ActiveSeconds > 0 {
+		stats.AverageSpeedMBps = stats.TotalDownloaded / stats.ActiveSeconds
+	}
+
+	stats.BandwidthBySource = GetBandwidthBySource()
+
+	return stats
+}
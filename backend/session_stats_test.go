@@ -0,0 +1,47 @@
+package backend
+
+import "testing"
+
+func TestRecomputeSessionStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(t *testing.T)
+		wantTotal float64
+	}{
+		{name: "unchanged queue", change: func(t *testing.T) {}, wantTotal: 15},
+		{
+			name: "completed item removed",
+			change: func(t *testing.T) {
+				if !RemoveQueueItem("tidal") {
+					t.Fatal("tidal item not found")
+				}
+			},
+			wantTotal: 5,
+		},
+		{
+			name: "stale running total",
+			change: func(t *testing.T) {
+				totalDownloadedLock.Lock()
+				totalDownloaded = 99
+				totalDownloadedLock.Unlock()
+			},
+			wantTotal: 15,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueueState(t)
+			path := writeQueueFile(t, persistedQueue{Version: queueFileVersion, Items: mixedHistory})
+			if err := LoadQueueFromFile(path); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(t)
+			RecomputeSessionStats()
+			if got := GetSessionStats().TotalDownloaded; got != tt.wantTotal {
+				t.Errorf("total downloaded = %v, want %v", got, tt.wantTotal)
+			}
+		})
+	}
+}
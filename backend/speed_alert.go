@@ -0,0 +1,171 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	speedSampleInterval       = time.Second
+	speedAlertCooldown        = 30 * time.Second
+	defaultSamplerIdleTimeout = time.Minute
+)
+
+type speedAlert struct {
+	threshold float64
+	below     bool
+	sustain   time.Duration
+	callback  func(current float64)
+	armed     bool
+	since     time.Time
+	lastFired time.Time
+}
+
+var (
+	speedCeilingAlert *speedAlert
+	speedFloorAlert   *speedAlert
+	speedAlertLock    sync.Mutex
+
+	samplerRunning     bool
+	samplerIdleTimeout = defaultSamplerIdleTimeout
+	samplerLock        sync.Mutex
+)
+
+// SetSamplerIdleTimeout sets how long the speed sampler keeps running after
+// the last download finishes. It restarts when the next download begins.
+func SetSamplerIdleTimeout(d time.Duration) {
+	if d <= 0 {
+		d = defaultSamplerIdleTimeout
+	}
+	samplerLock.Lock()
+	samplerIdleTimeout = d
+	samplerLock.Unlock()
+}
+
+// SetSpeedAlert calls callback when the aggregate download speed rises above
+// thresholdMBps. It fires once per crossing and at most every
+// speedAlertCooldown. A nil callback or non-positive threshold disables it.
+func SetSpeedAlert(thresholdMBps float64, callback func(current float64)) {
+	speedAlertLock.Lock()
+	speedCeilingAlert = newSpeedAlert(thresholdMBps, false, 0, callback)
+	speedAlertLock.Unlock()
+	startSpeedSampler()
+}
+
+// speedAlertConfig returns the SetSpeedAlert threshold and callback, or zero
+// and nil when no alert is set.
+func speedAlertConfig() (float64, func(current float64)) {
+	speedAlertLock.Lock()
+	defer speedAlertLock.Unlock()
+	if speedCeilingAlert == nil {
+		return 0, nil
+	}
+	return speedCeilingAlert.threshold, speedCeilingAlert.callback
+}
+
+// SetSpeedDropAlert calls callback when downloads are active but the aggregate
+// speed has stayed below thresholdMBps for at least sustained.
+func SetSpeedDropAlert(thresholdMBps float64, sustained time.Duration, callback func(current float64)) {
+	speedAlertLock.Lock()
+	speedFloorAlert = newSpeedAlert(thresholdMBps, true, sustained, callback)
+	speedAlertLock.Unlock()
+	startSpeedSampler()
+}
+
+func newSpeedAlert(threshold float64, below bool, sustain time.Duration, callback func(float64)) *speedAlert {
+	if callback == nil || threshold <= 0 {
+		return nil
+	}
+	return &speedAlert{
+		threshold: threshold,
+		below:     below,
+		sustain:   sustain,
+		callback:  callback,
+		armed:     true,
+	}
+}
+
+func startSpeedSampler() {
+	speedAlertLock.Lock()
+	configured := speedCeilingAlert != nil || speedFloorAlert != nil
+	speedAlertLock.Unlock()
+	if !configured {
+		return
+	}
+
+	samplerLock.Lock()
+	defer samplerLock.Unlock()
+	if samplerRunning {
+		return
+	}
+	samplerRunning = true
+	go runSpeedSampler()
+}
+
+func runSpeedSampler() {
+	ticker := time.NewTicker(speedSampleInterval)
+	defer ticker.Stop()
+
+	lastActive := time.Now()
+	for now := range ticker.C {
+		sampleSpeedAlerts(now)
+
+		if atomic.LoadInt64(&activeDownloads) > 0 {
+			lastActive = now
+			continue
+		}
+
+		samplerLock.Lock()
+		if now.Sub(lastActive) >= samplerIdleTimeout && atomic.LoadInt64(&activeDownloads) == 0 {
+			samplerRunning = false
+			samplerLock.Unlock()
+			return
+		}
+		samplerLock.Unlock()
+	}
+}
+
+func sampleSpeedAlerts(now time.Time) {
+	speedLock.RLock()
+	speed := currentSpeed
+	speedLock.RUnlock()
+	downloading := atomic.LoadInt64(&activeDownloads) > 0
+
+	speedAlertLock.Lock()
+	var fire []func(float64)
+	for _, alert := range []*speedAlert{speedCeilingAlert, speedFloorAlert} {
+		if alert != nil && alert.check(speed, downloading, now) {
+			fire = append(fire, alert.callback)
+		}
+	}
+	speedAlertLock.Unlock()
+
+	for _, callback := range fire {
+		callback(speed)
+	}
+}
+
+func (a *speedAlert) check(speed float64, downloading bool, now time.Time) bool {
+	triggered := speed > a.threshold
+	if a.below {
+		triggered = downloading && speed < a.threshold
+	}
+
+	if !triggered {
+		a.armed = true
+		a.since = time.Time{}
+		return false
+	}
+
+	if a.since.IsZero() {
+		a.since = now
+	}
+	if !a.armed || now.Sub(a.since) < a.sustain || now.Sub(a.lastFired) < speedAlertCooldown {
+		return false
+	}
+
+	a.armed = false
+	a.lastFired = now
+	return true
+}
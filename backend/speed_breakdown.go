@@ -0,0 +1,36 @@
+package backend
+
+// writerItems maps writer IDs to the item they download and is guarded by
+// speedLock.
+var writerItems = make(map[uint64]string)
+
+func setItemWriterSpeed(writerID uint64, itemID string, mbps float64) {
+	speedLock.Lock()
+	if itemID != "" {
+		writerItems[writerID] = itemID
+	}
+	writerSpeeds[writerID] = mbps
+	recomputeSpeedLocked()
+	speedLock.Unlock()
+}
+
+// GetAggregateSpeedExcluding returns the combined speed in MB/s of every
+// active writer except those downloading id, or the full aggregate when id is
+// not downloading. Like the aggregate, it reads 0 while the queue is paused.
+func GetAggregateSpeedExcluding(id string) float64 {
+	if queuePaused.Load() {
+		return 0
+	}
+
+	speedLock.RLock()
+	defer speedLock.RUnlock()
+
+	var total float64
+	for writerID, speed := range writerSpeeds {
+		if id != "" && writerItems[writerID] == id {
+			continue
+		}
+		total += speed
+	}
+	return total
+}
@@ -0,0 +1,58 @@
+package backend
+
+import "sync/atomic"
+
+type StateTransition struct {
+	Status   DownloadStatus `json:"status"`
+	AtMillis int64          `json:"at_millis"`
+}
+
+var trackStateHistory atomic.Bool
+
+// SetTrackStateHistory records every status change on each item in
+// StateHistory. It is off by default to save memory.
+func SetTrackStateHistory(enabled bool) {
+	trackStateHistory.Store(enabled)
+}
+
+func recordStateTransitionLocked(eventType QueueEventType, item *DownloadItem) {
+	if !trackStateHistory.Load() || eventType == EventItemProgress || item.ID == "" {
+		return
+	}
+
+	index := indexOfItemLocked(item.ID)
+	if index < 0 {
+		return
+	}
+	stored := &downloadQueue[index]
+	if n := len(stored.StateHistory); n > 0 && stored.StateHistory[n-1].Status == stored.Status {
+		return
+	}
+
+	stored.StateHistory = append(stored.StateHistory, StateTransition{
+		Status:   stored.Status,
+		AtMillis: getCurrentTimeMillis(),
+	})
+	item.StateHistory = append([]StateTransition(nil), stored.StateHistory...)
+}
+
+// GetStatuses returns the current status of each requested item under a
+// single read lock. IDs that are not in the queue are left out of the map.
+func GetStatuses(ids []string) map[string]DownloadStatus {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	statuses := make(map[string]DownloadStatus, len(ids))
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	for _, item := range downloadQueue {
+		if wanted[item.ID] {
+			statuses[item.ID] = item.Status
+		}
+	}
+	return statuses
+}
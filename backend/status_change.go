@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type StatusChangeHandler func(id string, from, to DownloadStatus)
+
+type statusChange struct {
+	id       string
+	from, to DownloadStatus
+}
+
+var (
+	statusHandlers     = make(map[int]StatusChangeHandler)
+	statusHandlersLock sync.RWMutex
+	statusHandlerCount atomic.Int64
+	nextStatusHandler  int
+
+	// knownStatuses is guarded by downloadQueueLock.
+	knownStatuses map[string]DownloadStatus
+
+	pendingStatusChanges []statusChange
+	pendingStatusLock    sync.Mutex
+	statusChangeSignal   = make(chan struct{}, 1)
+	statusDispatcherRun  sync.Once
+)
+
+// OnStatusChange registers handler to be called for every status transition of
+// every item, including queued to downloading, retries back to queued and
+// finishing. Newly added items are reported with an empty from status.
+// Handlers run asynchronously on a single goroutine, one transition at a time
+// in the order they happened, so a slow handler delays the others. The
+// returned function unregisters the handler.
+func OnStatusChange(handler func(id string, from, to DownloadStatus)) func() {
+	downloadQueueLock.Lock()
+	statusHandlersLock.Lock()
+	id := nextStatusHandler
+	nextStatusHandler++
+	statusHandlers[id] = handler
+	if statusHandlerCount.Add(1) == 1 {
+		knownStatuses = make(map[string]DownloadStatus, len(downloadQueue))
+		for _, item := range downloadQueue {
+			knownStatuses[item.ID] = item.Status
+		}
+	}
+	statusHandlersLock.Unlock()
+	downloadQueueLock.Unlock()
+
+	statusDispatcherRun.Do(func() {
+		go dispatchStatusChanges()
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			statusHandlersLock.Lock()
+			delete(statusHandlers, id)
+			statusHandlerCount.Add(-1)
+			statusHandlersLock.Unlock()
+		})
+	}
+}
+
+// trackStatusChangeLocked compares the status carried by an event with the
+// last one seen for the item and queues a notification when it differs.
+// Queue-wide events reconcile every item.
+func trackStatusChangeLocked(eventType QueueEventType, item DownloadItem) {
+	if statusHandlerCount.Load() == 0 {
+		knownStatuses = nil
+		return
+	}
+	if knownStatuses == nil {
+		knownStatuses = make(map[string]DownloadStatus, len(downloadQueue))
+	}
+
+	var changes []statusChange
+	switch {
+	case eventType == EventItemRemoved:
+		delete(knownStatuses, item.ID)
+	case item.ID == "":
+		present := make(map[string]bool, len(downloadQueue))
+		for _, queued := range downloadQueue {
+			present[queued.ID] = true
+			if from, ok := knownStatuses[queued.ID]; !ok || from != queued.Status {
+				changes = append(changes, statusChange{id: queued.ID, from: from, to: queued.Status})
+				knownStatuses[queued.ID] = queued.Status
+			}
+		}
+		for id := range knownStatuses {
+			if !present[id] {
+				delete(knownStatuses, id)
+			}
+		}
+	default:
+		if from, ok := knownStatuses[item.ID]; !ok || from != item.Status {
+			changes = append(changes, statusChange{id: item.ID, from: from, to: item.Status})
+			knownStatuses[item.ID] = item.Status
+		}
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+	pendingStatusLock.Lock()
+	pendingStatusChanges = append(pendingStatusChanges, changes...)
+	pendingStatusLock.Unlock()
+
+	select {
+	case statusChangeSignal <- struct{}{}:
+	default:
+	}
+}
+
+func dispatchStatusChanges() {
+	for range statusChangeSignal {
+		pendingStatusLock.Lock()
+		changes := pendingStatusChanges
+		pendingStatusChanges = nil
+		pendingStatusLock.Unlock()
+
+		statusHandlersLock.RLock()
+		handlers := make([]StatusChangeHandler, 0, len(statusHandlers))
+		for _, handler := range statusHandlers {
+			handlers = append(handlers, handler)
+		}
+		statusHandlersLock.RUnlock()
+
+		for _, change := range changes {
+			for _, handler := range handlers {
+				handler(change.id, change.from, change.to)
+			}
+		}
+	}
+}
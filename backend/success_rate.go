@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NoSuccessRateData is returned by GetSuccessRate when no item finished
+// within the window.
+const NoSuccessRateData = -1.0
+
+var successRateCountsSkipped atomic.Bool
+
+// SetSuccessRateCountsSkipped controls whether skipped items count as
+// successes in GetSuccessRate. They are excluded by default.
+func SetSuccessRateCountsSkipped(enabled bool) {
+	successRateCountsSkipped.Store(enabled)
+}
+
+// GetSuccessRate returns completed / (completed + failed) over the items whose
+// EndTime falls within the last window, or NoSuccessRateData when there are
+// none.
+func GetSuccessRate(window time.Duration) float64 {
+	cutoff := time.Now().Add(-window).Unix()
+	countSkipped := successRateCountsSkipped.Load()
+
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	var succeeded, finished int
+	for _, item := range downloadQueue {
+		if item.EndTime == 0 || item.EndTime < cutoff {
+			continue
+		}
+		switch item.Status {
+		case StatusCompleted:
+			succeeded++
+			finished++
+		case StatusFailed:
+			finished++
+		case StatusSkipped:
+			if countSkipped {
+				succeeded++
+				finished++
+			}
+		}
+	}
+
+	if finished == 0 {
+		return NoSuccessRateData
+	}
+	return float64(succeeded) / float64(finished)
+}
@@ -3,12 +3,18 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
 	"runtime"
 	"strings"
+	"syscall"
 )
 
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
 func GetOSInfo() (string, error) {
 	osType := runtime.GOOS
 	arch := runtime.GOARCH
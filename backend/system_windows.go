@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
 	"runtime"
@@ -8,6 +9,14 @@ import (
 	"syscall"
 )
 
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when a file is moved
+// to another drive.
+const errorNotSameDevice = syscall.Errno(17)
+
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
 func GetOSInfo() (string, error) {
 	arch := runtime.GOARCH
 
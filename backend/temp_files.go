@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+const tempFileSuffix = ".part"
+
+var tempFilesDisabled atomic.Bool
+
+// SetUseTempFiles makes downloads write to the target path plus ".part" and
+// rename the file into place only once the transfer has finished and its size
+// checks out, so the library never holds a half-written file under its real
+// name. The ".part" file is what SetResumePartialDownloads continues and what
+// the failure file action applies to. On by default.
+func SetUseTempFiles(enabled bool) {
+	tempFilesDisabled.Store(!enabled)
+}
+
+// tempFilePath returns the path a download for path should be written to.
+func tempFilePath(path string) string {
+	if tempFilesDisabled.Load() {
+		return path
+	}
+	return path + tempFileSuffix
+}
+
+// createTempFile creates the temporary file a download for path is written
+// to and returns it with its name.
+func createTempFile(path string) (*os.File, string, error) {
+	target := tempFilePath(path)
+	out, err := os.Create(target)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, target, nil
+}
+
+// downloadViaTempFile runs download against the temporary path for path and
+// commits the result.
+func downloadViaTempFile(itemID, path string, download func(target string) error) error {
+	target := tempFilePath(path)
+	if err := download(target); err != nil {
+		return err
+	}
+	return commitTempFile(itemID, target, path)
+}
+
+// commitTempFile verifies the finished temporary file against the size the
+// server reported for it and renames it to path. Estimated sizes are not
+// compared, since they are rarely exact. A truncated file is left in place to
+// be resumed or handled by the failure file action.
+func commitTempFile(itemID, target, path string) error {
+	if target == path {
+		return nil
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return transferError(itemID, fmt.Errorf("failed to verify file: %w", err), 0)
+	}
+	if expected := getItemContentLength(itemID); expected > 0 && info.Size() < expected {
+		return newDownloadError(itemID, ErrorCategoryNetwork, fmt.Errorf("download truncated at %d of %d bytes", info.Size(), expected), info.Size())
+	}
+
+	if err := os.Rename(target, path); err != nil {
+		return transferError(itemID, fmt.Errorf("failed to move file into place: %w", err), 0)
+	}
+	return nil
+}
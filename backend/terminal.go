@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const terminalRefreshInterval = 250 * time.Millisecond
+
+type TerminalProgressRenderer struct {
+	out        io.Writer
+	isTTY      bool
+	mu         sync.Mutex
+	running    bool
+	stop       chan struct{}
+	done       chan struct{}
+	linesDrawn int
+}
+
+func NewTerminalProgressRenderer(out io.Writer) *TerminalProgressRenderer {
+	if out == nil {
+		out = os.Stdout
+	}
+	return &TerminalProgressRenderer{
+		out:   out,
+		isTTY: isTerminal(out),
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *TerminalProgressRenderer) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		return
+	}
+	r.running = true
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	r.linesDrawn = 0
+
+	suppressInlineOutput.Store(true)
+
+	events, unsubscribe := SubscribeQueueEventsWithItems()
+	go r.run(events, unsubscribe)
+}
+
+func (r *TerminalProgressRenderer) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	close(r.stop)
+	done := r.done
+	r.mu.Unlock()
+
+	<-done
+	suppressInlineOutput.Store(false)
+}
+
+func (r *TerminalProgressRenderer) run(events <-chan QueueEvent, unsubscribe func()) {
+	defer close(r.done)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(terminalRefreshInterval)
+	defer ticker.Stop()
+
+	dirty := true
+	for {
+		select {
+		case <-r.stop:
+			if r.isTTY {
+				r.render()
+			}
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if r.isTTY {
+				dirty = true
+			} else {
+				r.printPlain(event)
+			}
+		case <-ticker.C:
+			if r.isTTY && dirty {
+				r.render()
+				dirty = false
+			}
+		}
+	}
+}
+
+func (r *TerminalProgressRenderer) printPlain(event QueueEvent) {
+	if event.Item == nil {
+		return
+	}
+	item := *event.Item
+	switch event.Type {
+	case EventItemStarted:
+		fmt.Fprintf(r.out, "[started] %s - %s\n", item.TrackName, item.ArtistName)
+	case EventItemCompleted:
+		fmt.Fprintf(r.out, "[completed] %s - %s (%.2f MB)\n", item.TrackName, item.ArtistName, item.TotalSize)
+	case EventItemFailed:
+		fmt.Fprintf(r.out, "[failed] %s - %s: %s\n", item.TrackName, item.ArtistName, item.ErrorMessage)
+	case EventItemSkipped:
+		fmt.Fprintf(r.out, "[skipped] %s - %s\n", item.TrackName, item.ArtistName)
+	}
+}
+
+func (r *TerminalProgressRenderer) render() {
+	lines := buildTerminalLines()
+
+	var b strings.Builder
+	if r.linesDrawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", r.linesDrawn)
+	}
+	for _, line := range lines {
+		b.WriteString("\033[2K\r")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	for i := len(lines); i < r.linesDrawn; i++ {
+		b.WriteString("\033[2K\n")
+	}
+	if extra := r.linesDrawn - len(lines); extra > 0 {
+		fmt.Fprintf(&b, "\033[%dA", extra)
+	}
+
+	io.WriteString(r.out, b.String())
+	r.linesDrawn = len(lines)
+}
+
+func buildTerminalLines() []string {
+	downloadQueueLock.RLock()
+	var lines []string
+	var queued, completed, failed, skipped int
+	for _, item := range downloadQueue {
+		switch item.Status {
+		case StatusDownloading:
+			lines = append(lines, fmt.Sprintf("%s - %s: %.2f MB (%.2f MB/s)", item.TrackName, item.ArtistName, item.Progress, item.Speed))
+		case StatusQueued:
+			queued++
+		case StatusCompleted:
+			completed++
+		case StatusFailed:
+			failed++
+		case StatusSkipped:
+			skipped++
+		}
+	}
+	downloadQueueLock.RUnlock()
+
+	speedLock.RLock()
+	speed := currentSpeed
+	speedLock.RUnlock()
+
+	totalDownloadedLock.RLock()
+	total := totalDownloaded
+	totalDownloadedLock.RUnlock()
+
+	summary := fmt.Sprintf("Active: %d | Queued: %d | Completed: %d | Failed: %d | Skipped: %d | %.2f MB (%.2f MB/s)",
+		len(lines), queued, completed, failed, skipped, total, speed)
+	return append(lines, summary)
+}
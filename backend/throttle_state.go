@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	throttleReleaseDelay = 2 * time.Second
+	throttleCheckEvery   = 500 * time.Millisecond
+)
+
+type ThrottleStateHandler func(throttling bool)
+
+var (
+	throttling         atomic.Bool
+	lastGlobalThrottle atomic.Int64
+	throttleNotifyLock sync.Mutex
+
+	throttleHandlers     = make(map[int]ThrottleStateHandler)
+	throttleHandlersLock sync.RWMutex
+	nextThrottleHandler  int
+)
+
+// IsThrottling reports whether the global bandwidth limit is currently
+// holding downloads back, as opposed to the sources simply being slow.
+func IsThrottling() bool {
+	return throttling.Load()
+}
+
+// OnThrottleStateChange registers handler to be called when downloads start or
+// stop being limited by SetBandwidthLimit. Throttling is reported as soon as
+// the limiter delays a write and cleared only after it has not delayed any for
+// two seconds, so handlers are not called on every short burst. Handlers run
+// on a background goroutine, in order. The returned function unregisters the
+// handler.
+func OnThrottleStateChange(handler func(throttling bool)) func() {
+	throttleHandlersLock.Lock()
+	id := nextThrottleHandler
+	nextThrottleHandler++
+	throttleHandlers[id] = handler
+	throttleHandlersLock.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			throttleHandlersLock.Lock()
+			delete(throttleHandlers, id)
+			throttleHandlersLock.Unlock()
+		})
+	}
+}
+
+// markGlobalThrottle records that the global limiter delayed a write.
+func markGlobalThrottle() {
+	lastGlobalThrottle.Store(getCurrentTimeMillis())
+	if throttling.CompareAndSwap(false, true) {
+		go watchThrottleState()
+	}
+}
+
+// watchThrottleState reports the start of a throttled period and then waits
+// for it to end. Only one runs at a time, and notifications are serialized so
+// a new period is never reported before the previous one has ended.
+func watchThrottleState() {
+	throttleNotifyLock.Lock()
+	notifyThrottleHandlers(true)
+	throttleNotifyLock.Unlock()
+
+	ticker := time.NewTicker(throttleCheckEvery)
+	defer ticker.Stop()
+	for range ticker.C {
+		quiet := time.Duration(getCurrentTimeMillis()-lastGlobalThrottle.Load()) * time.Millisecond
+		if quiet < throttleReleaseDelay {
+			continue
+		}
+
+		throttleNotifyLock.Lock()
+		throttling.Store(false)
+		notifyThrottleHandlers(false)
+		throttleNotifyLock.Unlock()
+		return
+	}
+}
+
+func notifyThrottleHandlers(state bool) {
+	throttleHandlersLock.RLock()
+	handlers := make([]ThrottleStateHandler, 0, len(throttleHandlers))
+	for _, handler := range throttleHandlers {
+		handlers = append(handlers, handler)
+	}
+	throttleHandlersLock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(state)
+	}
+}
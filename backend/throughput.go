@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const minThroughputWindowMillis = 250
+
+var (
+	aggregateBytes atomic.Int64
+
+	throughputSampleTime  int64
+	throughputSampleBytes int64
+	throughputRate        float64
+	throughputLock        sync.Mutex
+)
+
+// GetThroughputEfficiency compares the measured aggregate transfer rate with
+// the sum of the per-writer speeds. Values near 1 mean the active downloads do
+// not contend for bandwidth; it returns 0 when nothing is downloading.
+func GetThroughputEfficiency() float64 {
+	speedLock.RLock()
+	var itemSum float64
+	for _, speed := range writerSpeeds {
+		itemSum += speed
+	}
+	speedLock.RUnlock()
+
+	aggregate := measureAggregateRate()
+	if itemSum <= 0 || aggregate <= 0 || atomic.LoadInt64(&activeDownloads) == 0 {
+		return 0
+	}
+
+	efficiency := aggregate / itemSum
+	if efficiency > 1 {
+		efficiency = 1
+	}
+	return efficiency
+}
+
+func measureAggregateRate() float64 {
+	throughputLock.Lock()
+	defer throughputLock.Unlock()
+
+	now := speedClock()
+	bytes := aggregateBytes.Load()
+	elapsed := now - throughputSampleTime
+	if throughputSampleTime == 0 || elapsed < 0 {
+		throughputSampleTime, throughputSampleBytes = now, bytes
+		return 0
+	}
+	if elapsed < minThroughputWindowMillis {
+		return throughputRate
+	}
+
+	throughputRate = float64(bytes-throughputSampleBytes) / bytesPerMiB / (float64(elapsed) / 1000.0)
+	throughputSampleTime, throughputSampleBytes = now, bytes
+	return throughputRate
+}
+
+func resetThroughputSample() {
+	throughputLock.Lock()
+	throughputSampleTime = 0
+	throughputSampleBytes = 0
+	throughputRate = 0
+	throughputLock.Unlock()
+}
@@ -22,6 +22,8 @@ type TidalDownloader struct {
 	timeout    time.Duration
 	maxRetries int
 	apiURL     string
+	itemID     string
+	outputPath string
 }
 
 type TidalAPIResponse struct {
@@ -77,6 +79,16 @@ func NewTidalDownloader(apiURL string) *TidalDownloader {
 	}
 }
 
+func (t *TidalDownloader) SetItemID(itemID string) {
+	t.itemID = itemID
+}
+
+// SetOutputPath makes the downloader write to path, the one planned for the
+// item, instead of the path built from the filename format.
+func (t *TidalDownloader) SetOutputPath(path string) {
+	t.outputPath = path
+}
+
 func (t *TidalDownloader) GetAvailableAPIs() ([]string, error) {
 	apis := []string{
 		"https://triton.squid.wtf",
@@ -157,7 +169,7 @@ func (t *TidalDownloader) GetDownloadURL(trackID int64, quality string) (string,
 	url := fmt.Sprintf("%s/track/?id=%d&quality=%s", t.apiURL, trackID, quality)
 	fmt.Printf("Tidal API URL: %s\n", url)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := newItemRequest(t.itemID, "GET", url, nil)
 	if err != nil {
 		fmt.Printf("✗ failed to create request: %v\n", err)
 		return "", fmt.Errorf("failed to create request: %w", err)
@@ -222,34 +234,62 @@ func (t *TidalDownloader) DownloadFile(url, filepath string) error {
 		return t.DownloadFromManifest(strings.TrimPrefix(url, "MANIFEST:"), filepath)
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	return downloadViaTempFile(t.itemID, filepath, func(target string) error {
+		return t.downloadFile(url, target)
+	})
+}
+
+func (t *TidalDownloader) downloadFile(url, filepath string) error {
+	setUserAgent := withItemHeaders(t.itemID, func(req *http.Request) {
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/145.0.0.0 Safari/537.36")
+	})
+	if handled, err := resumeDownload(t.client, url, filepath, t.itemID, setUserAgent); handled {
+		if err != nil {
+			return err
+		}
+		fmt.Println("Download complete")
+		return nil
+	}
+	if handled, err := downloadSegmented(t.client, url, filepath, t.itemID, setUserAgent); handled {
+		if err != nil {
+			return err
+		}
+		fmt.Println("Download complete")
+		return nil
+	}
+
+	req, err := newItemDownloadRequest(t.itemID, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/145.0.0.0 Safari/537.36")
+	setUserAgent(req)
 
 	resp, err := t.client.Do(req)
 
 	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+		return transferError(t.itemID, fmt.Errorf("failed to download file: %w", err), 0)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+		return statusError(t.itemID, resp.StatusCode, fmt.Errorf("download failed with status %d", resp.StatusCode))
 	}
 
 	out, err := os.Create(filepath)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return transferError(t.itemID, fmt.Errorf("failed to create file: %w", err), 0)
 	}
 	defer out.Close()
 
-	pw := NewProgressWriter(out)
-	_, err = io.Copy(pw, resp.Body)
+	pw := NewProgressWriterWithID(out, t.itemID)
+
+	_, err = io.Copy(pw, pw.ResponseBody(resp))
+	if finishErr := pw.Finish(); err == nil {
+		err = finishErr
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return transferError(t.itemID, fmt.Errorf("failed to write file: %w", err), pw.GetTotal())
 	}
 
 	fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
@@ -269,11 +309,12 @@ func (t *TidalDownloader) DownloadFromManifest(manifestB64, outputPath string) e
 	}
 
 	doRequest := func(url string) (*http.Response, error) {
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := newItemDownloadRequest(t.itemID, "GET", url, nil)
 		if err != nil {
 			return nil, err
 		}
 		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/145.0.0.0 Safari/537.36")
+		applyItemHeaders(req, t.itemID)
 		return client.Do(req)
 	}
 
@@ -290,17 +331,28 @@ func (t *TidalDownloader) DownloadFromManifest(manifestB64, outputPath string) e
 			return fmt.Errorf("download failed with status %d", resp.StatusCode)
 		}
 
-		out, err := os.Create(outputPath)
+		out, target, err := createTempFile(outputPath)
 		if err != nil {
 			return fmt.Errorf("failed to create file: %w", err)
 		}
 		defer out.Close()
 
-		pw := NewProgressWriter(out)
+		pw := NewProgressWriterWithID(out, t.itemID)
+
+		pw.SetExpectedSize(resp.ContentLength)
 		_, err = io.Copy(pw, resp.Body)
+		if finishErr := pw.Finish(); err == nil {
+			err = finishErr
+		}
+		if err == nil {
+			err = out.Close()
+		}
 		if err != nil {
 			return fmt.Errorf("failed to write file: %w", err)
 		}
+		if err := commitTempFile(t.itemID, target, outputPath); err != nil {
+			return err
+		}
 
 		fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
 		fmt.Println("Download complete")
@@ -327,8 +379,13 @@ func (t *TidalDownloader) DownloadFromManifest(manifestB64, outputPath string) e
 			return fmt.Errorf("failed to create temp file: %w", err)
 		}
 
-		pw := NewProgressWriter(out)
+		pw := NewProgressWriterWithID(out, t.itemID)
+
+		pw.SetExpectedSize(resp.ContentLength)
 		_, err = io.Copy(pw, resp.Body)
+		if finishErr := pw.Finish(); err == nil {
+			err = finishErr
+		}
 		out.Close()
 
 		if err != nil {
@@ -445,10 +502,8 @@ func (t *TidalDownloader) DownloadFromManifest(manifestB64, outputPath string) e
 }
 
 func (t *TidalDownloader) DownloadByURL(tidalURL, outputDir, quality, filenameFormat string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate string, useAlbumTrackNumber bool, spotifyCoverURL string, embedMaxQualityCover bool, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, allowFallback bool, useFirstArtistOnly bool, useSingleGenre bool, embedGenre bool) (string, error) {
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("directory error: %w", err)
-		}
+	if err := ensureOutputDir(outputDir); err != nil {
+		return "", err
 	}
 
 	fmt.Printf("Using Tidal URL: %s\n", tidalURL)
@@ -478,7 +533,7 @@ func (t *TidalDownloader) DownloadByURL(tidalURL, outputDir, quality, filenameFo
 	albumTitleForFile := sanitizeFilename(albumTitle)
 
 	filename := buildTidalFilename(trackTitleForFile, artistNameForFile, albumTitleForFile, albumArtistForFile, spotifyReleaseDate, spotifyTrackNumber, spotifyDiscNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	outputFilename := filepath.Join(outputDir, filename)
+	outputFilename := plannedOutputPath(t.outputPath, filepath.Join(outputDir, filename))
 
 	if fileInfo, err := os.Stat(outputFilename); err == nil && fileInfo.Size() > 0 {
 		fmt.Printf("File already exists: %s (%.2f MB)\n", outputFilename, float64(fileInfo.Size())/(1024*1024))
@@ -603,10 +658,8 @@ func (t *TidalDownloader) DownloadByURLWithFallback(tidalURL, outputDir, quality
 		return "", fmt.Errorf("no APIs available for fallback: %w", err)
 	}
 
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("directory error: %w", err)
-		}
+	if err := ensureOutputDir(outputDir); err != nil {
+		return "", err
 	}
 
 	fmt.Printf("Using Tidal URL: %s\n", tidalURL)
@@ -636,7 +689,7 @@ func (t *TidalDownloader) DownloadByURLWithFallback(tidalURL, outputDir, quality
 	albumTitleForFile := sanitizeFilename(albumTitle)
 
 	filename := buildTidalFilename(trackTitleForFile, artistNameForFile, albumTitleForFile, albumArtistForFile, spotifyReleaseDate, spotifyTrackNumber, spotifyDiscNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	outputFilename := filepath.Join(outputDir, filename)
+	outputFilename := plannedOutputPath(t.outputPath, filepath.Join(outputDir, filename))
 
 	if fileInfo, err := os.Stat(outputFilename); err == nil && fileInfo.Size() > 0 {
 		fmt.Printf("File already exists: %s (%.2f MB)\n", outputFilename, float64(fileInfo.Size())/(1024*1024))
@@ -694,6 +747,7 @@ func (t *TidalDownloader) DownloadByURLWithFallback(tidalURL, outputDir, quality
 
 	fmt.Printf("Downloading to: %s\n", outputFilename)
 	downloader := NewTidalDownloader(successAPI)
+	downloader.SetItemID(t.itemID)
 	if err := downloader.DownloadFile(downloadURL, outputFilename); err != nil {
 		return "", err
 	}
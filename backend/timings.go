@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+)
+
+func SetItemResolveMillis(id string, millis int64) {
+	updateItemTiming(id, func(item *DownloadItem) { item.ResolveMillis = millis })
+}
+
+func SetItemTTFBMillis(id string, millis int64) {
+	updateItemTiming(id, func(item *DownloadItem) { item.TTFBMillis = millis })
+}
+
+// newItemDownloadRequest is newItemRequest for a request that fetches the file
+// itself. The first response byte of the attempt sets the item's TTFB.
+func newItemDownloadRequest(itemID, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := newItemRequest(itemID, method, url, body)
+	if err != nil || itemID == "" {
+		return req, err
+	}
+
+	sent := getCurrentTimeMillis()
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			recordItemTTFB(itemID, getCurrentTimeMillis()-sent)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), nil
+}
+
+// recordItemTTFB keeps the first TTFB of the attempt, so the later requests of
+// a segmented or resumed download do not overwrite it.
+func recordItemTTFB(id string, millis int64) {
+	updateItemTiming(id, func(item *DownloadItem) {
+		if item.TTFBMillis == 0 {
+			item.TTFBMillis = millis
+		}
+	})
+}
+
+func SetItemTransferMillis(id string, millis int64) {
+	updateItemTiming(id, func(item *DownloadItem) { item.TransferMillis = millis })
+}
+
+func updateItemTiming(id string, apply func(item *DownloadItem)) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			apply(&downloadQueue[i])
+			return
+		}
+	}
+}
+
+type ItemTiming struct {
+	ID             string `json:"id"`
+	TrackName      string `json:"track_name"`
+	Status         string `json:"status"`
+	ResolveMillis  int64  `json:"resolve_millis"`
+	TTFBMillis     int64  `json:"ttfb_millis"`
+	TransferMillis int64  `json:"transfer_millis"`
+}
+
+func collectItemTimings() []ItemTiming {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	var timings []ItemTiming
+	for _, item := range downloadQueue {
+		if item.ResolveMillis == 0 && item.TTFBMillis == 0 && item.TransferMillis == 0 {
+			continue
+		}
+		timings = append(timings, ItemTiming{
+			ID:             item.ID,
+			TrackName:      item.TrackName,
+			Status:         string(item.Status),
+			ResolveMillis:  item.ResolveMillis,
+			TTFBMillis:     item.TTFBMillis,
+			TransferMillis: item.TransferMillis,
+		})
+	}
+	return timings
+}
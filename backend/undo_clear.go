@@ -0,0 +1,93 @@
+package backend
+
+type clearSnapshot struct {
+	queue        []DownloadItem
+	removed      []DownloadItem
+	full         bool
+	total        float64
+	sessionStart int64
+	pausedMillis int64
+	meta         map[string]string
+}
+
+// lastClear is guarded by downloadQueueLock.
+var lastClear *clearSnapshot
+
+func stashClearLocked(full bool) {
+	snapshot := &clearSnapshot{
+		queue: append([]DownloadItem(nil), downloadQueue...),
+		full:  full,
+	}
+	if full {
+		snapshot.removed = append([]DownloadItem(nil), removedItems...)
+		snapshot.meta = GetSessionMeta()
+
+		totalDownloadedLock.RLock()
+		snapshot.total = totalDownloaded
+		totalDownloadedLock.RUnlock()
+
+		sessionStartLock.RLock()
+		snapshot.sessionStart = sessionStartTime
+		snapshot.pausedMillis = sessionPausedMillis
+		sessionStartLock.RUnlock()
+	}
+	lastClear = snapshot
+}
+
+func invalidateUndoLocked(eventType QueueEventType) {
+	if eventType == EventItemProgress || eventType == EventQueueCleared || eventType == EventQueueRestored {
+		return
+	}
+	lastClear = nil
+}
+
+// UndoLastClear restores the queue as it was before the most recent
+// ClearDownloadQueue or ClearAllDownloads. It returns false when there is
+// nothing to undo, including when the queue has changed since the clear.
+func UndoLastClear() bool {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	snapshot := lastClear
+	if snapshot == nil {
+		return false
+	}
+	lastClear = nil
+
+	current := make(map[string]DownloadItem, len(downloadQueue))
+	for _, item := range downloadQueue {
+		current[item.ID] = item
+	}
+
+	restored := make([]DownloadItem, 0, len(snapshot.queue))
+	for _, item := range snapshot.queue {
+		if live, ok := current[item.ID]; ok {
+			item = live
+			delete(current, item.ID)
+		}
+		restored = append(restored, item)
+	}
+	for _, item := range downloadQueue {
+		if _, ok := current[item.ID]; ok {
+			restored = append(restored, item)
+		}
+	}
+	downloadQueue = restored
+
+	if snapshot.full {
+		removedItems = snapshot.removed
+		replaceSessionMeta(snapshot.meta)
+
+		totalDownloadedLock.Lock()
+		totalDownloaded = snapshot.total
+		totalDownloadedLock.Unlock()
+
+		sessionStartLock.Lock()
+		sessionStartTime = snapshot.sessionStart
+		sessionPausedMillis = snapshot.pausedMillis
+		sessionStartLock.Unlock()
+	}
+
+	publishQueueEvent(EventQueueRestored, DownloadItem{})
+	return true
+}